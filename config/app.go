@@ -35,11 +35,50 @@ type AlipayConfig struct {
 }
 
 type AlipayAppConfig struct {
-	AppId           string `yaml:"appId"`
-	PrivateKey      string `yaml:"privateKey"`
-	AlipayPublicKey string `yaml:"alipayPublicKey"`
-	NotifyURL       string `yaml:"notify_url"`
-	ReturnURL       string `yaml:"return_url"`
+	AppId            string `yaml:"appId"`
+	SellerId         string `yaml:"sellerId"`
+	PrivateKey       string `yaml:"privateKey"`
+	AlipayPublicKey  string `yaml:"alipayPublicKey"`
+	AppPublicCert    string `yaml:"appPublicCert"`
+	AlipayPublicCert string `yaml:"alipayPublicCert"`
+	AlipayRootCert   string `yaml:"alipayRootCert"`
+	NotifyURL        string `yaml:"notify_url"`
+	ReturnURL        string `yaml:"return_url"`
+}
+
+type ReconcilerConfig struct {
+	Enabled         bool  `yaml:"enabled"`
+	IntervalSeconds int   `yaml:"interval_seconds"`
+	Concurrency     int   `yaml:"concurrency"`
+	BatchSize       int   `yaml:"batch_size"`
+	BackoffSeconds  []int `yaml:"backoff_seconds"`
+}
+
+type BillReconcilerConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Hour 为空时使用默认的 10 点，0 表示零点
+	Hour                 *int `yaml:"hour"`
+	RetryIntervalMinutes int  `yaml:"retry_interval_minutes"`
+	MaxRetries           int  `yaml:"max_retries"`
+}
+
+type WebhookConfig struct {
+	Enabled         bool `yaml:"enabled"`
+	IntervalSeconds int  `yaml:"interval_seconds"`
+	Concurrency     int  `yaml:"concurrency"`
+	BatchSize       int  `yaml:"batch_size"`
+	MaxAttempts     int  `yaml:"max_attempts"`
+	TimeoutSeconds  int  `yaml:"timeout_seconds"`
+	BackoffSeconds  int  `yaml:"backoff_seconds"`
+}
+
+type OutboxConfig struct {
+	Enabled         bool     `yaml:"enabled"`
+	IntervalSeconds int      `yaml:"interval_seconds"`
+	BatchSize       int      `yaml:"batch_size"`
+	BackoffSeconds  int      `yaml:"backoff_seconds"`
+	Sinks           []string `yaml:"sinks"`
+	BrokerTopic     string   `yaml:"broker_topic"`
 }
 
 type PayConfig struct {
@@ -54,6 +93,11 @@ type AppConfig struct {
 	Pay    PayConfig    `yaml:"pay"`
 	Alipay AlipayConfig `yaml:"alipay"`
 	MySQL  MySQLConfig  `yaml:"mysql"`
+
+	Reconciler     ReconcilerConfig     `yaml:"reconciler"`
+	BillReconciler BillReconcilerConfig `yaml:"bill_reconciler"`
+	Webhook        WebhookConfig        `yaml:"webhook"`
+	Outbox         OutboxConfig         `yaml:"outbox"`
 }
 
 func LoadConfig(configPath string) (AppConfig, error) {
@@ -79,6 +123,20 @@ func LoadConfig(configPath string) (AppConfig, error) {
 			Enabled: true,
 			Header:  "X-Trace-Id",
 		},
+		Reconciler: ReconcilerConfig{
+			Enabled: true,
+		},
+		BillReconciler: BillReconcilerConfig{
+			Enabled: true,
+		},
+		Webhook: WebhookConfig{
+			Enabled: true,
+		},
+		Outbox: OutboxConfig{
+			Enabled:     true,
+			Sinks:       []string{"webhook", "log"},
+			BrokerTopic: "order_events",
+		},
 	}
 
 	if data, err := os.ReadFile(filepath.Clean(configPath)); err == nil && len(data) > 0 {
@@ -0,0 +1,116 @@
+package alipaytest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"time"
+
+	"pay/ealipay"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const billPathPrefix = "/bill/"
+
+var beijing = time.FixedZone("CST", 8*3600)
+
+var errBillNotExist = &ealipay.Error{Code: "40004", Msg: "Business Failed", SubCode: "isp.bill_not_exist", SubMsg: "账单不存在"}
+
+func (s *Server) billDownloadURLQuery(biz map[string]any) (map[string]any, *ealipay.Error) {
+	if str(biz, "bill_type") != ealipay.BillTypeTrade {
+		return nil, errBillNotExist
+	}
+	if _, err := time.ParseInLocation(time.DateOnly, str(biz, "bill_date"), beijing); err != nil {
+		return nil, errInvalidParameter
+	}
+	return map[string]any{"bill_download_url": s.URL + billPathPrefix + str(biz, "bill_date")}, nil
+}
+
+// serveBill 返回 GBK 编码的业务明细 zip：当天付款的交易记为交易行，当天发生的退款记为负金额的退款行。
+func (s *Server) serveBill(w http.ResponseWriter, r *http.Request) {
+	day, err := time.ParseInLocation(time.DateOnly, strings.TrimPrefix(r.URL.Path, billPathPrefix), beijing)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := s.BillZip(day)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	_, _ = w.Write(data)
+}
+
+// BillZip 按账本生成 day 当天的业务明细账单 zip，格式与支付宝下载的账单一致。
+func (s *Server) BillZip(day time.Time) ([]byte, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, beijing)
+	end := start.AddDate(0, 0, 1)
+	inDay := func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+
+	var detail bytes.Buffer
+	detail.WriteString("#支付宝业务明细查询\n#账号：[" + s.SellerID + "]\n")
+	detail.WriteString("#起始日期：[" + start.Format(time.DateTime) + "]   终止日期：[" + end.Format(time.DateTime) + "]\n")
+	detail.WriteString("#-----------------------------------------业务明细列表----------------------------------------\n")
+	cw := csv.NewWriter(&detail)
+	_ = cw.Write([]string{"支付宝交易号", "商户订单号", "业务类型", "商品名称", "创建时间", "完成时间", "门店编号", "门店名称", "操作员", "终端号", "对方账户", "订单金额（元）", "商家实收（元）", "支付宝红包（元）", "集分宝（元）", "支付宝优惠（元）", "商家优惠（元）", "券核销金额（元）", "券名称", "商家红包消费金额（元）", "卡消费金额（元）", "退款批次号/请求号", "服务费（元）", "分润（元）", "备注"})
+
+	s.mu.Lock()
+	for _, trade := range s.trades {
+		if !trade.GmtPayment.IsZero() && inDay(trade.GmtPayment) {
+			_ = cw.Write(billRow(trade, "交易", trade.GmtPayment, trade.TotalAmount, ""))
+		}
+		for outRequestNo, amount := range trade.Refunds {
+			if at := trade.RefundTimes[outRequestNo]; inDay(at) {
+				_ = cw.Write(billRow(trade, "退款", at, "-"+amount, outRequestNo))
+			}
+		}
+	}
+	s.mu.Unlock()
+	cw.Flush()
+	detail.WriteString("#-----------------------------------------业务明细列表结束------------------------------------\n")
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	name := s.SellerID + "_" + start.Format("20060102")
+	files := []struct {
+		name    string
+		content string
+	}{
+		{name + "_业务明细.csv", detail.String()},
+		{name + "_业务明细(汇总).csv", "#支付宝业务汇总查询\n"},
+	}
+	for _, f := range files {
+		gbkName, err := simplifiedchinese.GBK.NewEncoder().String(f.name)
+		if err != nil {
+			return nil, err
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: gbkName, Method: zip.Deflate, NonUTF8: true})
+		if err != nil {
+			return nil, err
+		}
+		content, err := simplifiedchinese.GBK.NewEncoder().String(f.content)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func billRow(trade *Trade, bizType string, at time.Time, amount, outRequestNo string) []string {
+	return []string{
+		trade.TradeNo, trade.OutTradeNo, bizType, trade.Subject,
+		trade.GmtCreate.In(beijing).Format(time.DateTime), at.In(beijing).Format(time.DateTime),
+		"", "", "", "", trade.BuyerID, amount, amount, "0.00", "0.00", "0.00", "0.00", "0.00", "", "0.00", "0.00",
+		outRequestNo, "0.00", "0.00", "",
+	}
+}
@@ -0,0 +1,104 @@
+package alipaytest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"pay/ealipay"
+)
+
+// NotifyParams 按交易当前状态生成一份已签名的异步通知参数。
+// 同一份参数可以多次发送，用于模拟支付宝的重复通知。
+func (s *Server) NotifyParams(outTradeNo string) (url.Values, error) {
+	s.mu.Lock()
+	trade, ok := s.trades[outTradeNo]
+	if !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("trade %s not found", outTradeNo)
+	}
+	t := *trade
+	s.seq++
+	notifyID := fmt.Sprintf("%s%08d", time.Now().Format("20060102150405"), s.seq)
+	s.mu.Unlock()
+
+	params := map[string]string{
+		"notify_time":     ealipay.FormatTime(time.Now()),
+		"notify_type":     "trade_status_sync",
+		"notify_id":       notifyID,
+		"app_id":          s.AppID,
+		"auth_app_id":     s.AppID,
+		"charset":         "utf-8",
+		"version":         "1.0",
+		"sign_type":       "RSA2",
+		"seller_id":       s.SellerID,
+		"buyer_id":        t.BuyerID,
+		"out_trade_no":    t.OutTradeNo,
+		"trade_no":        t.TradeNo,
+		"trade_status":    t.Status,
+		"total_amount":    t.TotalAmount,
+		"subject":         t.Subject,
+		"gmt_create":      ealipay.FormatTime(t.GmtCreate),
+		"passback_params": t.PassbackArgs,
+	}
+	if !t.GmtPayment.IsZero() {
+		params["gmt_payment"] = ealipay.FormatTime(t.GmtPayment)
+		params["receipt_amount"] = t.TotalAmount
+		params["buyer_pay_amount"] = t.TotalAmount
+		params["fund_bill_list"] = fmt.Sprintf(`[{"amount":"%s","fundChannel":"ALIPAYACCOUNT"}]`, t.TotalAmount)
+	}
+	if t.RefundedFee > 0 {
+		params["refund_fee"] = t.RefundedFee.String()
+		params["gmt_refund"] = time.Now().In(beijing).Format("2006-01-02 15:04:05.000")
+	}
+
+	sign, err := signContent(s.AlipayPrivateKey, []byte(notifySignContent(params)))
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for k, v := range params {
+		if v != "" {
+			values.Set(k, v)
+		}
+	}
+	values.Set("sign", sign)
+	return values, nil
+}
+
+// Notify 向 NotifyURL 发送交易当前状态的异步通知，返回商户的应答内容。
+func (s *Server) Notify(ctx context.Context, outTradeNo string) (string, error) {
+	values, err := s.NotifyParams(outTradeNo)
+	if err != nil {
+		return "", err
+	}
+	return s.SendNotify(ctx, s.NotifyURL, values)
+}
+
+func (s *Server) SendNotify(ctx context.Context, notifyURL string, values url.Values) (string, error) {
+	if notifyURL == "" {
+		return "", fmt.Errorf("notify url is empty")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifyURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
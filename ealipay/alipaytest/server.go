@@ -0,0 +1,284 @@
+// Package alipaytest 提供一个基于 httptest 的本地支付宝网关模拟器，用于离线测试。
+//
+// 模拟器使用随机生成的密钥对：校验请求的 RSA2 签名，在内存中维护交易账本，
+// 对查询、关单、撤销、退款、退款查询、预下单和付款码支付返回正确签名的响应，
+// 按账本生成可下载的业务明细账单，并能向配置的 notify_url 发送签名的异步通知。
+//
+//	srv := alipaytest.NewServer()
+//	defer srv.Close()
+//	srv.NotifyURL = appServer.URL + "/api/alipay/notify"
+//	client, _ := ealipay.NewClient(srv.Config())
+package alipaytest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"pay/ealipay"
+)
+
+const (
+	DefaultAppID    = "2021000000000000"
+	DefaultSellerID = "2088000000000000"
+)
+
+type Server struct {
+	URL       string
+	AppID     string
+	SellerID  string
+	NotifyURL string
+
+	AppPrivateKey    *rsa.PrivateKey
+	AlipayPrivateKey *rsa.PrivateKey
+
+	srv      *httptest.Server
+	mu       sync.Mutex
+	trades   map[string]*Trade
+	failures map[string][]ealipay.Error
+	requests []Request
+	seq      int
+}
+
+// Request 记录模拟网关收到的一次已验签请求。
+type Request struct {
+	Method     string
+	Params     map[string]string
+	BizContent map[string]any
+}
+
+func NewServer() *Server {
+	s := &Server{
+		AppID:            DefaultAppID,
+		SellerID:         DefaultSellerID,
+		AppPrivateKey:    mustGenerateKey(),
+		AlipayPrivateKey: mustGenerateKey(),
+		trades:           make(map[string]*Trade),
+		failures:         make(map[string][]ealipay.Error),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveGateway))
+	s.URL = s.srv.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Config 返回指向模拟网关的客户端配置，密钥与模拟器互相匹配。
+func (s *Server) Config() *ealipay.Config {
+	return &ealipay.Config{
+		AppId:           s.AppID,
+		SellerId:        s.SellerID,
+		PrivateKey:      encodePrivateKey(s.AppPrivateKey),
+		AlipayPublicKey: encodePublicKey(&s.AlipayPrivateKey.PublicKey),
+		GatewayURL:      s.URL,
+		NotifyURL:       s.NotifyURL,
+	}
+}
+
+// FailNext 让下一次调用 method 时返回指定的错误响应，可多次调用排队。
+func (s *Server) FailNext(method string, e ealipay.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], e)
+}
+
+// Requests 返回已收到的请求，按到达顺序排列。
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) serveGateway(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, billPathPrefix) {
+		s.serveBill(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := make(map[string]string, len(r.Form))
+	for k, vs := range r.Form {
+		if len(vs) > 0 {
+			params[k] = vs[0]
+		}
+	}
+
+	method := params["method"]
+	responseKey := strings.ReplaceAll(method, ".", "_") + "_response"
+
+	if params["app_id"] != s.AppID {
+		s.writeError(w, "error_response", ealipay.Error{Code: "40002", Msg: "Invalid Arguments", SubCode: "isv.invalid-app-id", SubMsg: "无效的AppID参数"})
+		return
+	}
+	if params["sign_type"] != ealipay.SignType {
+		s.writeError(w, "error_response", ealipay.Error{Code: "40002", Msg: "Invalid Arguments", SubCode: "isv.invalid-signature-type", SubMsg: "无效的签名类型"})
+		return
+	}
+	if err := verify(&s.AppPrivateKey.PublicKey, requestSignContent(params), params["sign"]); err != nil {
+		s.writeError(w, "error_response", ealipay.Error{Code: "40002", Msg: "Invalid Arguments", SubCode: "isv.invalid-signature", SubMsg: "验签出错"})
+		return
+	}
+
+	biz := map[string]any{}
+	if content := params["biz_content"]; content != "" {
+		if err := json.Unmarshal([]byte(content), &biz); err != nil {
+			s.writeError(w, responseKey, ealipay.Error{Code: "40002", Msg: "Invalid Arguments", SubCode: "isv.invalid-parameter", SubMsg: "biz_content 格式错误"})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: method, Params: params, BizContent: biz})
+	if queued := s.failures[method]; len(queued) > 0 {
+		s.failures[method] = queued[1:]
+		s.mu.Unlock()
+		s.writeError(w, responseKey, queued[0])
+		return
+	}
+	s.mu.Unlock()
+
+	var (
+		resp   map[string]any
+		apiErr *ealipay.Error
+	)
+	switch method {
+	case "alipay.trade.query":
+		resp, apiErr = s.tradeQuery(biz)
+	case "alipay.trade.close":
+		resp, apiErr = s.tradeClose(biz)
+	case "alipay.trade.cancel":
+		resp, apiErr = s.tradeCancel(biz)
+	case "alipay.trade.refund":
+		resp, apiErr = s.tradeRefund(biz)
+	case "alipay.trade.fastpay.refund.query":
+		resp, apiErr = s.tradeRefundQuery(biz)
+	case "alipay.trade.precreate":
+		resp, apiErr = s.tradePrecreate(biz)
+	case "alipay.trade.pay":
+		resp, apiErr = s.tradePay(biz)
+	case "alipay.data.dataservice.bill.downloadurl.query":
+		resp, apiErr = s.billDownloadURLQuery(biz)
+	default:
+		s.writeError(w, "error_response", ealipay.Error{Code: "40002", Msg: "Invalid Arguments", SubCode: "isv.invalid-method", SubMsg: "不存在的方法名"})
+		return
+	}
+	if apiErr != nil {
+		s.writeError(w, responseKey, *apiErr)
+		return
+	}
+
+	resp["code"] = ealipay.CodeSuccess
+	resp["msg"] = "Success"
+	s.writeResponse(w, responseKey, resp)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, responseKey string, e ealipay.Error) {
+	resp := map[string]any{"code": e.Code, "msg": e.Msg}
+	if e.SubCode != "" {
+		resp["sub_code"] = e.SubCode
+	}
+	if e.SubMsg != "" {
+		resp["sub_msg"] = e.SubMsg
+	}
+	s.writeResponse(w, responseKey, resp)
+}
+
+// writeResponse 对响应节点的原始字节签名，与真实网关的行为一致。
+func (s *Server) writeResponse(w http.ResponseWriter, responseKey string, node map[string]any) {
+	raw, err := json.Marshal(node)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sign, err := signContent(s.AlipayPrivateKey, raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key, _ := json.Marshal(responseKey)
+	signJSON, _ := json.Marshal(sign)
+
+	w.Header().Set("Content-Type", "text/html;charset=utf-8")
+	fmt.Fprintf(w, `{%s:%s,"sign":%s}`, key, raw, signJSON)
+}
+
+func requestSignContent(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if k == "sign" || v == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+params[k])
+	}
+	return strings.Join(pairs, "&")
+}
+
+func notifySignContent(params map[string]string) string {
+	filtered := make(map[string]string, len(params))
+	for k, v := range params {
+		if k == "sign_type" {
+			continue
+		}
+		filtered[k] = v
+	}
+	return requestSignContent(filtered)
+}
+
+func signContent(key *rsa.PrivateKey, content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func verify(key *rsa.PublicKey, content, sign string) error {
+	sig, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(content))
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig)
+}
+
+func mustGenerateKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func encodePrivateKey(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func encodePublicKey(key *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		panic(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
@@ -0,0 +1,143 @@
+package alipaytest_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"pay/ealipay"
+	"pay/ealipay/alipaytest"
+)
+
+func newClient(t *testing.T, cfg *ealipay.Config) *ealipay.AlipayClient {
+	t.Helper()
+	client, err := ealipay.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func wantSubCode(t *testing.T, err error, subCode string) {
+	t.Helper()
+	apiErr, ok := ealipay.AsError(err)
+	if !ok {
+		t.Fatalf("err = %v, want alipay error %s", err, subCode)
+	}
+	if apiErr.SubCode != subCode {
+		t.Fatalf("sub_code = %s, want %s", apiErr.SubCode, subCode)
+	}
+}
+
+func TestServerRejectsBadRequestSign(t *testing.T) {
+	srv := alipaytest.NewServer()
+	defer srv.Close()
+	other := alipaytest.NewServer()
+	defer other.Close()
+
+	srv.CreateTrade("otn-1", "1.00", "test")
+
+	cfg := srv.Config()
+	cfg.PrivateKey = other.Config().PrivateKey
+	_, err := newClient(t, cfg).TradeQuery(&ealipay.TradeQueryRequest{OutTradeNo: "otn-1"})
+	wantSubCode(t, err, "isv.invalid-signature")
+
+	if n := len(srv.Requests()); n != 0 {
+		t.Fatalf("recorded %d requests with bad sign, want 0", n)
+	}
+}
+
+func TestServerRejectsWrongAppID(t *testing.T) {
+	srv := alipaytest.NewServer()
+	defer srv.Close()
+
+	cfg := srv.Config()
+	cfg.AppId = "2021999999999999"
+	_, err := newClient(t, cfg).TradeQuery(&ealipay.TradeQueryRequest{OutTradeNo: "otn-1"})
+	wantSubCode(t, err, "isv.invalid-app-id")
+}
+
+func TestServerRejectsWrongSignType(t *testing.T) {
+	srv := alipaytest.NewServer()
+	defer srv.Close()
+
+	resp, err := http.PostForm(srv.URL, url.Values{
+		"app_id":    {srv.AppID},
+		"method":    {"alipay.trade.query"},
+		"sign_type": {"RSA"},
+		"sign":      {"bm90LWEtc2lnbg=="},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var envelope struct {
+		ErrorResponse ealipay.Error `json:"error_response"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	if envelope.ErrorResponse.SubCode != "isv.invalid-signature-type" {
+		t.Fatalf("sub_code = %s, want isv.invalid-signature-type", envelope.ErrorResponse.SubCode)
+	}
+}
+
+func TestServerSignsResponses(t *testing.T) {
+	srv := alipaytest.NewServer()
+	defer srv.Close()
+	other := alipaytest.NewServer()
+	defer other.Close()
+
+	srv.CreateTrade("otn-1", "1.00", "test")
+
+	resp, err := newClient(t, srv.Config()).TradeQuery(&ealipay.TradeQueryRequest{OutTradeNo: "otn-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TradeStatus != alipaytest.TradeStatusWaitBuyerPay {
+		t.Fatalf("trade_status = %s, want %s", resp.TradeStatus, alipaytest.TradeStatusWaitBuyerPay)
+	}
+
+	// 用另一份支付宝公钥验签必须失败
+	cfg := srv.Config()
+	cfg.AlipayPublicKey = other.Config().AlipayPublicKey
+	if _, err := newClient(t, cfg).TradeQuery(&ealipay.TradeQueryRequest{OutTradeNo: "otn-1"}); err == nil {
+		t.Fatal("response verified with unrelated alipay public key")
+	}
+}
+
+func TestNotifyParamsAreSigned(t *testing.T) {
+	srv := alipaytest.NewServer()
+	defer srv.Close()
+
+	srv.CreateTrade("otn-1", "12.34", "test")
+	if _, err := srv.Pay("otn-1", ""); err != nil {
+		t.Fatal(err)
+	}
+	values, err := srv.NotifyParams("otn-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newClient(t, srv.Config())
+	n, err := client.VerifyNotification(ealipay.NotificationParams(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.TradeStatus != alipaytest.TradeStatusSuccess || n.TotalAmount.String() != "12.34" {
+		t.Fatalf("notification = %s %s, want %s 12.34", n.TradeStatus, n.TotalAmount, alipaytest.TradeStatusSuccess)
+	}
+
+	tampered := ealipay.NotificationParams(values)
+	tampered["total_amount"] = "0.01"
+	if _, err := client.VerifyNotification(tampered); err == nil {
+		t.Fatal("tampered notification verified")
+	}
+}
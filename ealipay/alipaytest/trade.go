@@ -0,0 +1,331 @@
+package alipaytest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pay/ealipay"
+)
+
+const (
+	TradeStatusWaitBuyerPay = "WAIT_BUYER_PAY"
+	TradeStatusSuccess      = "TRADE_SUCCESS"
+	TradeStatusFinished     = "TRADE_FINISHED"
+	TradeStatusClosed       = "TRADE_CLOSED"
+)
+
+type Trade struct {
+	OutTradeNo   string
+	TradeNo      string
+	TotalAmount  string
+	Subject      string
+	Status       string
+	BuyerID      string
+	GmtCreate    time.Time
+	GmtPayment   time.Time
+	Refunds      map[string]string
+	RefundTimes  map[string]time.Time
+	RefundedFee  ealipay.Amount
+	PassbackArgs string
+}
+
+var (
+	errTradeNotExist    = &ealipay.Error{Code: "40004", Msg: "Business Failed", SubCode: ealipay.SubCodeTradeNotExist, SubMsg: "交易不存在"}
+	errTradeStatusError = &ealipay.Error{Code: "40004", Msg: "Business Failed", SubCode: ealipay.SubCodeTradeStatusError, SubMsg: "交易状态不合法"}
+	errTradeHasClose    = &ealipay.Error{Code: "40004", Msg: "Business Failed", SubCode: "ACQ.TRADE_HAS_CLOSE", SubMsg: "交易已经关闭"}
+	errRefundAmount     = &ealipay.Error{Code: "40004", Msg: "Business Failed", SubCode: "ACQ.REFUND_AMT_NOT_EQUAL_TOTAL", SubMsg: "退款金额超限"}
+	errInvalidParameter = &ealipay.Error{Code: "40002", Msg: "Invalid Arguments", SubCode: "isv.invalid-parameter", SubMsg: "参数无效"}
+)
+
+// CreateTrade 模拟买家扫码或登录后支付宝创建交易，此时交易处于 WAIT_BUYER_PAY。
+func (s *Server) CreateTrade(outTradeNo, totalAmount, subject string) *Trade {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createTradeLocked(outTradeNo, totalAmount, subject)
+}
+
+// Pay 模拟买家完成支付。页面支付的交易在买家付款前不存在，此时需要提供金额。
+func (s *Server) Pay(outTradeNo, totalAmount string) (*Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trade, ok := s.trades[outTradeNo]
+	if !ok {
+		if totalAmount == "" {
+			return nil, fmt.Errorf("trade %s not found", outTradeNo)
+		}
+		trade = s.createTradeLocked(outTradeNo, totalAmount, "")
+	}
+	if trade.Status != TradeStatusWaitBuyerPay {
+		return nil, fmt.Errorf("trade %s is %s", outTradeNo, trade.Status)
+	}
+	trade.Status = TradeStatusSuccess
+	trade.GmtPayment = time.Now()
+	copied := *trade
+	return &copied, nil
+}
+
+// SetTradeStatus 直接修改交易状态，用于构造边界场景。
+func (s *Server) SetTradeStatus(outTradeNo, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trade, ok := s.trades[outTradeNo]
+	if !ok {
+		return fmt.Errorf("trade %s not found", outTradeNo)
+	}
+	trade.Status = status
+	return nil
+}
+
+func (s *Server) Trade(outTradeNo string) (Trade, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trade, ok := s.trades[outTradeNo]
+	if !ok {
+		return Trade{}, false
+	}
+	return *trade, true
+}
+
+func (s *Server) createTradeLocked(outTradeNo, totalAmount, subject string) *Trade {
+	if trade, ok := s.trades[outTradeNo]; ok {
+		return trade
+	}
+	s.seq++
+	trade := &Trade{
+		OutTradeNo:  outTradeNo,
+		TradeNo:     fmt.Sprintf("%s%010d", time.Now().Format("20060102"), s.seq),
+		TotalAmount: totalAmount,
+		Subject:     subject,
+		Status:      TradeStatusWaitBuyerPay,
+		BuyerID:     "2088102177846880",
+		GmtCreate:   time.Now(),
+		Refunds:     make(map[string]string),
+		RefundTimes: make(map[string]time.Time),
+	}
+	s.trades[outTradeNo] = trade
+	return trade
+}
+
+func (s *Server) findTradeLocked(biz map[string]any) (*Trade, *ealipay.Error) {
+	if outTradeNo := str(biz, "out_trade_no"); outTradeNo != "" {
+		if trade, ok := s.trades[outTradeNo]; ok {
+			return trade, nil
+		}
+		return nil, errTradeNotExist
+	}
+	if tradeNo := str(biz, "trade_no"); tradeNo != "" {
+		for _, trade := range s.trades {
+			if trade.TradeNo == tradeNo {
+				return trade, nil
+			}
+		}
+		return nil, errTradeNotExist
+	}
+	return nil, errInvalidParameter
+}
+
+func (s *Server) tradeQuery(biz map[string]any) (map[string]any, *ealipay.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trade, apiErr := s.findTradeLocked(biz)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	resp := map[string]any{
+		"out_trade_no":  trade.OutTradeNo,
+		"trade_no":      trade.TradeNo,
+		"trade_status":  trade.Status,
+		"total_amount":  trade.TotalAmount,
+		"buyer_user_id": trade.BuyerID,
+	}
+	if !trade.GmtPayment.IsZero() {
+		resp["send_pay_date"] = ealipay.FormatTime(trade.GmtPayment)
+	}
+	return resp, nil
+}
+
+func (s *Server) tradeClose(biz map[string]any) (map[string]any, *ealipay.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trade, apiErr := s.findTradeLocked(biz)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if trade.Status != TradeStatusWaitBuyerPay {
+		return nil, errTradeStatusError
+	}
+	trade.Status = TradeStatusClosed
+	return map[string]any{"out_trade_no": trade.OutTradeNo, "trade_no": trade.TradeNo}, nil
+}
+
+func (s *Server) tradeCancel(biz map[string]any) (map[string]any, *ealipay.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trade, apiErr := s.findTradeLocked(biz)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	action := ealipay.CancelActionClose
+	switch trade.Status {
+	case TradeStatusWaitBuyerPay:
+	case TradeStatusSuccess:
+		action = ealipay.CancelActionRefund
+		total, _ := ealipay.ParseAmount(trade.TotalAmount)
+		trade.RefundedFee = total
+	case TradeStatusClosed:
+		action = ealipay.CancelActionNoRefund
+	default:
+		return nil, errTradeStatusError
+	}
+	trade.Status = TradeStatusClosed
+	return map[string]any{
+		"out_trade_no": trade.OutTradeNo,
+		"trade_no":     trade.TradeNo,
+		"retry_flag":   "N",
+		"action":       action,
+	}, nil
+}
+
+func (s *Server) tradeRefund(biz map[string]any) (map[string]any, *ealipay.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trade, apiErr := s.findTradeLocked(biz)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	outRequestNo := str(biz, "out_request_no")
+	if outRequestNo == "" {
+		outRequestNo = trade.OutTradeNo
+	}
+	amount, err := ealipay.ParseAmount(str(biz, "refund_amount"))
+	if err != nil || amount <= 0 {
+		return nil, errInvalidParameter
+	}
+
+	resp := map[string]any{
+		"out_trade_no":   trade.OutTradeNo,
+		"trade_no":       trade.TradeNo,
+		"buyer_logon_id": "buy***@alipay.com",
+	}
+
+	if existing, ok := trade.Refunds[outRequestNo]; ok {
+		if existing != amount.String() {
+			return nil, errInvalidParameter
+		}
+		resp["fund_change"] = "N"
+		resp["refund_fee"] = trade.RefundedFee.String()
+		return resp, nil
+	}
+
+	switch trade.Status {
+	case TradeStatusSuccess, TradeStatusFinished:
+	case TradeStatusClosed:
+		return nil, errTradeHasClose
+	default:
+		return nil, errTradeStatusError
+	}
+	total, _ := ealipay.ParseAmount(trade.TotalAmount)
+	if trade.RefundedFee+amount > total {
+		return nil, errRefundAmount
+	}
+
+	trade.Refunds[outRequestNo] = amount.String()
+	trade.RefundTimes[outRequestNo] = time.Now()
+	trade.RefundedFee += amount
+	if trade.RefundedFee == total {
+		trade.Status = TradeStatusClosed
+	}
+	resp["fund_change"] = "Y"
+	resp["refund_fee"] = trade.RefundedFee.String()
+	resp["gmt_refund_pay"] = ealipay.FormatTime(time.Now())
+	return resp, nil
+}
+
+func (s *Server) tradeRefundQuery(biz map[string]any) (map[string]any, *ealipay.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trade, apiErr := s.findTradeLocked(biz)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	resp := map[string]any{}
+	outRequestNo := str(biz, "out_request_no")
+	if amount, ok := trade.Refunds[outRequestNo]; ok {
+		resp["out_trade_no"] = trade.OutTradeNo
+		resp["trade_no"] = trade.TradeNo
+		resp["out_request_no"] = outRequestNo
+		resp["total_amount"] = trade.TotalAmount
+		resp["refund_amount"] = amount
+		resp["refund_status"] = ealipay.RefundStatusSuccess
+	}
+	return resp, nil
+}
+
+func (s *Server) tradePrecreate(biz map[string]any) (map[string]any, *ealipay.Error) {
+	outTradeNo := str(biz, "out_trade_no")
+	if outTradeNo == "" {
+		return nil, errInvalidParameter
+	}
+	if _, err := ealipay.ParseAmount(str(biz, "total_amount")); err != nil {
+		return nil, errInvalidParameter
+	}
+
+	trade := s.CreateTrade(outTradeNo, str(biz, "total_amount"), str(biz, "subject"))
+	return map[string]any{
+		"out_trade_no": trade.OutTradeNo,
+		"qr_code":      "https://qr.alipay.com/" + trade.TradeNo,
+	}, nil
+}
+
+// tradePay 模拟付款码支付：auth_code 以 "wait" 结尾时返回 10003 等待买家输入密码，
+// 其他情况直接支付成功。
+func (s *Server) tradePay(biz map[string]any) (map[string]any, *ealipay.Error) {
+	outTradeNo := str(biz, "out_trade_no")
+	if outTradeNo == "" || str(biz, "auth_code") == "" {
+		return nil, errInvalidParameter
+	}
+	if _, err := ealipay.ParseAmount(str(biz, "total_amount")); err != nil {
+		return nil, errInvalidParameter
+	}
+
+	trade := s.CreateTrade(outTradeNo, str(biz, "total_amount"), str(biz, "subject"))
+	resp := map[string]any{
+		"out_trade_no": trade.OutTradeNo,
+		"trade_no":     trade.TradeNo,
+		"total_amount": trade.TotalAmount,
+	}
+	if strings.HasSuffix(str(biz, "auth_code"), "wait") {
+		return nil, &ealipay.Error{Code: ealipay.CodeWaitBuyerPay, Msg: "order success pay inprocess"}
+	}
+
+	paid, err := s.Pay(outTradeNo, "")
+	if err != nil {
+		return nil, errTradeStatusError
+	}
+	resp["gmt_payment"] = ealipay.FormatTime(paid.GmtPayment)
+	resp["buyer_user_id"] = paid.BuyerID
+	return resp, nil
+}
+
+func str(m map[string]any, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
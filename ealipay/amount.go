@@ -0,0 +1,59 @@
+package ealipay
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount 是以分为单位的金额，对应支付宝接口中两位小数的元字符串。
+type Amount int64
+
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" || len(fracPart) > 2 {
+		return 0, fmt.Errorf("invalid amount: %q", s)
+	}
+	for len(fracPart) < 2 {
+		fracPart += "0"
+	}
+	yuan, err := strconv.ParseUint(intPart, 10, 63)
+	if err != nil || yuan > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("invalid amount: %q", s)
+	}
+	cents, err := strconv.ParseUint(fracPart, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount: %q", s)
+	}
+	return Amount(yuan*100 + cents), nil
+}
+
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, a/100, a%100)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*a = 0
+		return nil
+	}
+	v, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
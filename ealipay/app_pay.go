@@ -2,8 +2,6 @@ package ealipay
 
 import (
 	"net/url"
-	"sort"
-	"strings"
 )
 
 type AppPayRequest struct {
@@ -12,6 +10,7 @@ type AppPayRequest struct {
 	Subject        string `json:"subject"`
 	Body           string `json:"body,omitempty"`
 	TimeoutExpress string `json:"timeout_express,omitempty"`
+	TimeExpire     string `json:"time_expire,omitempty"`
 	ProductCode    string `json:"product_code"`
 }
 
@@ -23,12 +22,13 @@ type AppPayResponse struct {
 	OrderStr string `json:"order_str"`
 }
 
+// AppPay 生成 App 支付的 order_str，由客户端原样传给支付宝 SDK 唤起支付。
 func (c *AlipayClient) AppPay(req *AppPayRequest) (string, error) {
 	if req.ProductCode == "" {
-		req.ProductCode = "QUICK_WAP_WAY"
+		req.ProductCode = "QUICK_MSECURITY_PAY"
 	}
 
-	if req.TimeoutExpress == "" {
+	if req.TimeoutExpress == "" && req.TimeExpire == "" {
 		req.TimeoutExpress = "30m"
 	}
 
@@ -39,26 +39,9 @@ func (c *AlipayClient) AppPay(req *AppPayRequest) (string, error) {
 
 	params := c.buildCommonParams("alipay.trade.app.pay", bizContent)
 	params["timestamp"] = getCurrentTimestamp()
+	delete(params, "return_url")
 
-	keys := make([]string, 0, len(params))
-	for k := range params {
-		if k != "sign" {
-			keys = append(keys, k)
-		}
-	}
-	sort.Strings(keys)
-
-	var builder strings.Builder
-	for i, k := range keys {
-		if i > 0 {
-			builder.WriteString("&")
-		}
-		builder.WriteString(k)
-		builder.WriteString("=")
-		builder.WriteString(params[k])
-	}
-
-	sign, err := c.sign(builder.String())
+	sign, err := c.generateSign(params)
 	if err != nil {
 		return "", err
 	}
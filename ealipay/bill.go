@@ -0,0 +1,75 @@
+package ealipay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	BillTypeTrade        = "trade"
+	BillTypeSignCustomer = "signcustomer"
+)
+
+const billDownloadURLQueryMethod = "alipay.data.dataservice.bill.downloadurl.query"
+
+// maxBillSize 限制下载的账单 zip 大小，防止异常链接耗尽内存。
+const maxBillSize = 256 << 20
+
+type BillDownloadURLQueryRequest struct {
+	// BillType 为 trade（业务明细）或 signcustomer（账务明细）
+	BillType string `json:"bill_type"`
+	// BillDate 为 yyyy-MM-dd 的日账单或 yyyy-MM 的月账单
+	BillDate string `json:"bill_date"`
+}
+
+type BillDownloadURLQueryResponse struct {
+	Code            string `json:"code"`
+	Msg             string `json:"msg"`
+	SubCode         string `json:"sub_code,omitempty"`
+	SubMsg          string `json:"sub_msg,omitempty"`
+	BillDownloadURL string `json:"bill_download_url,omitempty"`
+}
+
+func (c *AlipayClient) BillDownloadURLQuery(req *BillDownloadURLQueryRequest) (*BillDownloadURLQueryResponse, error) {
+	return c.BillDownloadURLQueryContext(context.Background(), req)
+}
+
+func (c *AlipayClient) BillDownloadURLQueryContext(ctx context.Context, req *BillDownloadURLQueryRequest) (*BillDownloadURLQueryResponse, error) {
+	if req == nil || req.BillType == "" || req.BillDate == "" {
+		return nil, fmt.Errorf("bill_type and bill_date are required")
+	}
+
+	return executeAs[BillDownloadURLQueryResponse](ctx, c, billDownloadURLQueryMethod, req)
+}
+
+// DownloadBill 下载 bill_download_url 指向的 zip 账单。下载链接 30 秒内有效，应在查询后立即下载。
+func (c *AlipayClient) DownloadBill(ctx context.Context, downloadURL string) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("download bill: http status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBillSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxBillSize {
+		return nil, fmt.Errorf("download bill: file exceeds %d bytes", maxBillSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,293 @@
+package ealipay
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/transform"
+)
+
+const (
+	BillBizTypeTrade  = "交易"
+	BillBizTypeRefund = "退款"
+)
+
+const billTimeLayout = "2006-01-02 15:04:05"
+
+var ErrEmptyBill = errors.New("bill zip contains no detail file")
+
+// Bill 是解压后的账单明细。zip 中的汇总文件被忽略，业务明细与账务明细按表头区分。
+type Bill struct {
+	TradeRows   []TradeBillRow
+	AccountRows []AccountBillRow
+}
+
+// TradeBillRow 是业务明细（bill_type=trade）中的一行。退款行的金额为负数。
+type TradeBillRow struct {
+	TradeNo       string
+	OutTradeNo    string
+	BizType       string
+	Subject       string
+	CreatedAt     time.Time
+	FinishedAt    time.Time
+	StoreID       string
+	BuyerAccount  string
+	TotalAmount   Amount
+	ReceiptAmount Amount
+	OutRequestNo  string
+	ServiceFee    Amount
+	Memo          string
+}
+
+// AccountBillRow 是账务明细（bill_type=signcustomer）中的一行。
+type AccountBillRow struct {
+	AccountLogID string
+	TradeNo      string
+	OutTradeNo   string
+	Subject      string
+	Time         time.Time
+	PeerAccount  string
+	InAmount     Amount
+	OutAmount    Amount
+	Balance      Amount
+	Channel      string
+	BizType      string
+	Memo         string
+}
+
+// ParseBillZip 解析 DownloadBill 返回的 zip。文件内容与文件名均为 GBK 编码。
+func ParseBillZip(data []byte) (*Bill, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open bill zip: %w", err)
+	}
+
+	bill := &Bill{}
+	found := false
+	for _, f := range zr.File {
+		name := f.Name
+		if f.NonUTF8 {
+			if decoded, err := decodeGBK([]byte(f.Name)); err == nil {
+				name = decoded
+			}
+		}
+		if f.FileInfo().IsDir() || strings.Contains(name, "汇总") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", name, err)
+		}
+		err = parseBillFile(transform.NewReader(rc, simplifiedchinese.GB18030.NewDecoder()), bill)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+		found = true
+	}
+	if !found {
+		return nil, ErrEmptyBill
+	}
+	return bill, nil
+}
+
+func decodeGBK(b []byte) (string, error) {
+	out, _, err := transform.Bytes(simplifiedchinese.GB18030.NewDecoder(), b)
+	return string(out), err
+}
+
+func parseBillFile(r io.Reader, bill *Bill) error {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.LazyQuotes = true
+	cr.FieldsPerRecord = -1
+
+	var header map[string]int
+	kind := ""
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for i := range record {
+			record[i] = strings.Trim(record[i], " \t\ufeff")
+		}
+
+		if header == nil {
+			header = billHeader(record)
+			switch {
+			case hasColumn(header, "支付宝交易号"):
+				kind = BillTypeTrade
+			case hasColumn(header, "账务流水号"):
+				kind = BillTypeSignCustomer
+			default:
+				// 表头之前的说明行
+				header = nil
+			}
+			continue
+		}
+
+		row := billRecord{header: header, values: record}
+		switch kind {
+		case BillTypeTrade:
+			if row.get("支付宝交易号") == "" {
+				continue
+			}
+			parsed, err := row.tradeRow()
+			if err != nil {
+				return err
+			}
+			bill.TradeRows = append(bill.TradeRows, parsed)
+		case BillTypeSignCustomer:
+			if row.get("账务流水号") == "" {
+				continue
+			}
+			parsed, err := row.accountRow()
+			if err != nil {
+				return err
+			}
+			bill.AccountRows = append(bill.AccountRows, parsed)
+		}
+	}
+}
+
+// billHeader 去掉列名中的单位说明，如 "订单金额（元）" 记为 "订单金额"。
+func billHeader(record []string) map[string]int {
+	header := make(map[string]int, len(record))
+	for i, name := range record {
+		if idx := strings.IndexAny(name, "（("); idx >= 0 {
+			name = name[:idx]
+		}
+		header[strings.TrimSpace(name)] = i
+	}
+	return header
+}
+
+func hasColumn(header map[string]int, name string) bool {
+	_, ok := header[name]
+	return ok
+}
+
+type billRecord struct {
+	header map[string]int
+	values []string
+}
+
+func (r billRecord) get(name string) string {
+	i, ok := r.header[name]
+	if !ok || i >= len(r.values) {
+		return ""
+	}
+	return r.values[i]
+}
+
+func (r billRecord) amount(name string) (Amount, error) {
+	v, err := parseSignedAmount(r.get(name))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return v, nil
+}
+
+func (r billRecord) time(name string) (time.Time, error) {
+	s := r.get(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(billTimeLayout, s, beijing)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+func (r billRecord) tradeRow() (TradeBillRow, error) {
+	row := TradeBillRow{
+		TradeNo:      r.get("支付宝交易号"),
+		OutTradeNo:   r.get("商户订单号"),
+		BizType:      r.get("业务类型"),
+		Subject:      r.get("商品名称"),
+		StoreID:      r.get("门店编号"),
+		BuyerAccount: r.get("对方账户"),
+		OutRequestNo: r.get("退款批次号/请求号"),
+		Memo:         r.get("备注"),
+	}
+	var err error
+	if row.CreatedAt, err = r.time("创建时间"); err != nil {
+		return row, err
+	}
+	if row.FinishedAt, err = r.time("完成时间"); err != nil {
+		return row, err
+	}
+	if row.TotalAmount, err = r.amount("订单金额"); err != nil {
+		return row, err
+	}
+	if row.ReceiptAmount, err = r.amount("商家实收"); err != nil {
+		return row, err
+	}
+	if row.ServiceFee, err = r.amount("服务费"); err != nil {
+		return row, err
+	}
+	return row, nil
+}
+
+func (r billRecord) accountRow() (AccountBillRow, error) {
+	row := AccountBillRow{
+		AccountLogID: r.get("账务流水号"),
+		TradeNo:      r.get("业务流水号"),
+		OutTradeNo:   r.get("商户订单号"),
+		Subject:      r.get("商品名称"),
+		PeerAccount:  r.get("对方账号"),
+		Channel:      r.get("交易渠道"),
+		BizType:      r.get("业务类型"),
+		Memo:         r.get("备注"),
+	}
+	var err error
+	if row.Time, err = r.time("发生时间"); err != nil {
+		return row, err
+	}
+	if row.InAmount, err = r.amount("收入金额"); err != nil {
+		return row, err
+	}
+	if row.OutAmount, err = r.amount("支出金额"); err != nil {
+		return row, err
+	}
+	if row.Balance, err = r.amount("账户余额"); err != nil {
+		return row, err
+	}
+	return row, nil
+}
+
+// parseSignedAmount 解析账单中的金额，允许负号与空值，空值记为 0。
+func parseSignedAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	v, err := ParseAmount(s)
+	if err != nil {
+		return 0, err
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
@@ -0,0 +1,251 @@
+package ealipay
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// certFailureTTL 是下载或校验失败的序列号在多久内不再重新下载
+	certFailureTTL = time.Minute
+	// certDownloadInterval 是两次证书下载之间的最小间隔。异步通知在验签之前没有任何认证，
+	// 伪造的 alipay_cert_sn 不能换来不受限制的下载请求
+	certDownloadInterval = 10 * time.Second
+)
+
+var (
+	errCertUnavailable       = errors.New("alipay cert recently failed to download or verify")
+	errCertDownloadThrottled = errors.New("alipay cert download throttled")
+)
+
+func parseCertificates(certStr string) ([]*x509.Certificate, error) {
+	rest := []byte(strings.TrimSpace(certStr))
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return certs, nil
+}
+
+func parseCertificate(certStr string) (*x509.Certificate, error) {
+	certs, err := parseCertificates(certStr)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+// certSN 按支付宝规则计算证书序列号：md5(签发者 DN + 十进制序列号)。
+func certSN(cert *x509.Certificate) string {
+	sum := md5.Sum([]byte(cert.Issuer.String() + cert.SerialNumber.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// rootCertSN 只取根证书链中 RSA 签名算法的证书，多个序列号以下划线连接。
+func rootCertSN(certs []*x509.Certificate) string {
+	sns := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		switch cert.SignatureAlgorithm {
+		case x509.SHA1WithRSA, x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA:
+			sns = append(sns, certSN(cert))
+		}
+	}
+	return strings.Join(sns, "_")
+}
+
+func certPublicKey(cert *x509.Certificate) (*rsa.PublicKey, error) {
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate public key is not RSA")
+	}
+	return pub, nil
+}
+
+func (c *AlipayClient) loadCerts(config *Config) error {
+	appCert, err := parseCertificate(config.AppPublicCert)
+	if err != nil {
+		return fmt.Errorf("parse app public cert failed: %w", err)
+	}
+
+	alipayCert, err := parseCertificate(config.AlipayPublicCert)
+	if err != nil {
+		return fmt.Errorf("parse alipay public cert failed: %w", err)
+	}
+	alipayPublicKey, err := certPublicKey(alipayCert)
+	if err != nil {
+		return fmt.Errorf("parse alipay public cert failed: %w", err)
+	}
+
+	rootCerts, err := parseCertificates(config.AlipayRootCert)
+	if err != nil {
+		return fmt.Errorf("parse alipay root cert failed: %w", err)
+	}
+
+	c.rootCertPool = x509.NewCertPool()
+	for _, cert := range rootCerts {
+		c.rootCertPool.AddCert(cert)
+	}
+
+	c.AppCertSN = certSN(appCert)
+	c.AlipayRootCertSN = rootCertSN(rootCerts)
+	c.AlipayCertSN = certSN(alipayCert)
+	c.AlipayPublicKey = alipayPublicKey
+	c.alipayPublicKeys = map[string]*rsa.PublicKey{c.AlipayCertSN: alipayPublicKey}
+	c.certFailed = make(map[string]time.Time)
+	c.certDownload = make(chan struct{}, 1)
+	return nil
+}
+
+// publicKeyForCertSN 返回与 alipay_cert_sn 对应的支付宝公钥。支付宝轮换证书后，
+// 响应中会带上新证书的序列号，此时下载新证书并用根证书校验后缓存。
+// 下载串行执行且至少间隔 certDownloadInterval，失败的序列号在 certFailureTTL 内直接返回错误。
+func (c *AlipayClient) publicKeyForCertSN(ctx context.Context, sn string) (*rsa.PublicKey, error) {
+	if sn == "" || c.AppCertSN == "" {
+		if c.AlipayPublicKey == nil {
+			return nil, fmt.Errorf("alipay public key not configured")
+		}
+		return c.AlipayPublicKey, nil
+	}
+
+	if key, err := c.cachedPublicKey(sn); key != nil || err != nil {
+		return key, err
+	}
+
+	select {
+	case c.certDownload <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.certDownload }()
+
+	// 等待期间其他请求可能已经下载了同一张证书
+	if key, err := c.cachedPublicKey(sn); key != nil || err != nil {
+		return key, err
+	}
+	if time.Since(c.certLastDownload) < certDownloadInterval {
+		return nil, fmt.Errorf("alipay cert %s: %w", sn, errCertDownloadThrottled)
+	}
+	c.certLastDownload = time.Now()
+
+	key, err := c.fetchPublicKey(ctx, sn)
+	if err != nil {
+		// 调用方放弃的请求不说明证书有问题，不记入失败缓存
+		if ctx.Err() == nil {
+			c.recordCertFailure(sn)
+		}
+		return nil, err
+	}
+
+	c.certMu.Lock()
+	c.alipayPublicKeys[sn] = key
+	c.certMu.Unlock()
+	return key, nil
+}
+
+// cachedPublicKey 返回已缓存的公钥，或未过期的失败记录对应的错误；两者都为 nil 表示需要下载。
+func (c *AlipayClient) cachedPublicKey(sn string) (*rsa.PublicKey, error) {
+	c.certMu.RLock()
+	defer c.certMu.RUnlock()
+
+	if key, ok := c.alipayPublicKeys[sn]; ok {
+		return key, nil
+	}
+	if until, ok := c.certFailed[sn]; ok && time.Now().Before(until) {
+		return nil, fmt.Errorf("alipay cert %s: %w", sn, errCertUnavailable)
+	}
+	return nil, nil
+}
+
+func (c *AlipayClient) recordCertFailure(sn string) {
+	c.certMu.Lock()
+	defer c.certMu.Unlock()
+
+	now := time.Now()
+	for failed, until := range c.certFailed {
+		if !now.Before(until) {
+			delete(c.certFailed, failed)
+		}
+	}
+	c.certFailed[sn] = now.Add(certFailureTTL)
+}
+
+// fetchPublicKey 下载 sn 对应的证书，校验证书链和序列号后返回公钥。
+func (c *AlipayClient) fetchPublicKey(ctx context.Context, sn string) (*rsa.PublicKey, error) {
+	certs, err := c.downloadAlipayCert(ctx, sn)
+	if err != nil {
+		return nil, fmt.Errorf("download alipay cert %s: %w", sn, err)
+	}
+	cert, err := verifyAlipayCert(certs, c.rootCertPool)
+	if err != nil {
+		return nil, fmt.Errorf("verify alipay cert %s: %w", sn, err)
+	}
+	if got := certSN(cert); got != sn {
+		return nil, fmt.Errorf("alipay cert sn mismatch: want %s, got %s", sn, got)
+	}
+	return certPublicKey(cert)
+}
+
+const certDownloadMethod = "alipay.open.app.alipaycert.download"
+
+type certDownloadRequest struct {
+	AlipayCertSN string `json:"alipay_cert_sn"`
+}
+
+type certDownloadResponse struct {
+	AlipayCertContent string `json:"alipay_cert_content"`
+}
+
+// verifyAlipayCert 校验下载的证书链：首张是支付宝公钥证书，其余作为中间证书参与建链。
+// 支付宝公钥证书不带 serverAuth 等扩展用途，因此不限制 ExtKeyUsage。
+func verifyAlipayCert(certs []*x509.Certificate, roots *x509.CertPool) (*x509.Certificate, error) {
+	intermediates := x509.NewCertPool()
+	for _, ic := range certs[1:] {
+		intermediates.AddCert(ic)
+	}
+	cert := certs[0]
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (c *AlipayClient) downloadAlipayCert(ctx context.Context, sn string) ([]*x509.Certificate, error) {
+	out, err := executeAs[certDownloadResponse](ctx, c, certDownloadMethod, &certDownloadRequest{AlipayCertSN: sn})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := base64.StdEncoding.DecodeString(out.AlipayCertContent)
+	if err != nil {
+		return nil, fmt.Errorf("decode alipay_cert_content: %w", err)
+	}
+	return parseCertificates(string(content))
+}
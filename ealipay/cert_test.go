@@ -0,0 +1,150 @@
+package ealipay
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, serial int64, cn string, isCA bool, parent *testCert) *testCert {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Ant Financial"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		// 与支付宝公钥证书一致，不设置 ExtKeyUsage
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	}
+	if isCA {
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func encodeCerts(certs ...*testCert) string {
+	var b strings.Builder
+	for _, c := range certs {
+		pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	}
+	return b.String()
+}
+
+func TestVerifyAlipayCertChain(t *testing.T) {
+	root := newTestCert(t, 1, "Ant Financial Certification Authority R1", true, nil)
+	intermediate := newTestCert(t, 2, "Ant Financial Certification Authority Class 2 R1", true, root)
+	leaf := newTestCert(t, 3, "alipay-public-key", false, intermediate)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+
+	certs, err := parseCertificates(encodeCerts(leaf, intermediate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := verifyAlipayCert(certs, roots)
+	if err != nil {
+		t.Fatalf("verify chain with intermediate: %v", err)
+	}
+	if certSN(got) != certSN(leaf.cert) {
+		t.Fatalf("verified cert = %s, want leaf %s", certSN(got), certSN(leaf.cert))
+	}
+
+	if _, err := verifyAlipayCert(certs[:1], roots); err == nil {
+		t.Fatal("verify without intermediate succeeded")
+	}
+
+	other := newTestCert(t, 4, "other root", true, nil)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other.cert)
+	if _, err := verifyAlipayCert(certs, otherRoots); err == nil {
+		t.Fatal("verify against unrelated root succeeded")
+	}
+}
+
+func TestPublicKeyForCertSNLimitsDownloads(t *testing.T) {
+	var downloads atomic.Int32
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer gateway.Close()
+
+	root := newTestCert(t, 1, "Ant Financial Certification Authority R1", true, nil)
+	appCert := newTestCert(t, 2, "app", false, root)
+	alipayCert := newTestCert(t, 3, "alipay-public-key", false, root)
+	client, err := NewClient(&Config{
+		AppId:            "2021000000000000",
+		PrivateKey:       string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(appCert.key)})),
+		AppPublicCert:    encodeCerts(appCert),
+		AlipayPublicCert: encodeCerts(alipayCert),
+		AlipayRootCert:   encodeCerts(root),
+		GatewayURL:       gateway.URL,
+		Retry:            RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if key, err := client.publicKeyForCertSN(ctx, client.AlipayCertSN); err != nil || key == nil {
+		t.Fatalf("configured cert sn: %v", err)
+	}
+	if _, err := client.publicKeyForCertSN(ctx, "forged-1"); err == nil {
+		t.Fatal("unknown cert sn verified")
+	}
+	if _, err := client.publicKeyForCertSN(ctx, "forged-1"); !errors.Is(err, errCertUnavailable) {
+		t.Fatalf("repeated failed sn error = %v, want errCertUnavailable", err)
+	}
+
+	// 伪造的序列号并发涌入时，下载间隔内不会再访问网关
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := client.publicKeyForCertSN(ctx, "forged-flood-"+string(rune('a'+i))); !errors.Is(err, errCertDownloadThrottled) {
+				t.Errorf("flood sn error = %v, want errCertDownloadThrottled", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := downloads.Load(); n != 1 {
+		t.Fatalf("cert downloads = %d, want 1", n)
+	}
+}
@@ -8,28 +8,67 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net/http"
 	"net/url"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 type AlipayClient struct {
-	AppId           string
-	PrivateKey      *rsa.PrivateKey
-	AlipayPublicKey *rsa.PublicKey
-	GatewayUrl      string
-	NotifyURL       string
-	ReturnURL       string
+	AppId            string
+	SellerId         string
+	PrivateKey       *rsa.PrivateKey
+	AlipayPublicKey  *rsa.PublicKey
+	GatewayUrl       string
+	NotifyURL        string
+	ReturnURL        string
+	AppCertSN        string
+	AlipayRootCertSN string
+	AlipayCertSN     string
+
+	httpClient       *http.Client
+	retry            RetryPolicy
+	breaker          *circuitBreaker
+	certMu           sync.RWMutex
+	alipayPublicKeys map[string]*rsa.PublicKey
+	// certFailed 记录下载或校验失败的序列号及其到期时间，由 certMu 保护
+	certFailed   map[string]time.Time
+	rootCertPool *x509.CertPool
+	// certDownload 是容量为 1 的信号量，同一时刻只下载一张证书；certLastDownload 由它保护
+	certDownload     chan struct{}
+	certLastDownload time.Time
 }
 
 type Config struct {
 	AppId           string
+	SellerId        string // 商户 PID（2088 开头），用于校验通知中的 seller_id
 	PrivateKey      string
 	AlipayPublicKey string
 	IsSandbox       bool
 	NotifyURL       string
 	ReturnURL       string
+
+	// 公钥证书模式：三个证书均为 PEM 内容，配置后忽略 AlipayPublicKey
+	AppPublicCert    string
+	AlipayPublicCert string
+	AlipayRootCert   string
+
+	// GatewayURL 覆盖默认网关地址，例如指向本地模拟网关
+	GatewayURL string
+	// HTTPClient 优先于 Transport；都不设置时使用 http.DefaultTransport
+	HTTPClient *http.Client
+	Transport  http.RoundTripper
+	// Timeout 是单次网关请求的超时时间，默认 15s；HTTPClient 非空时不生效
+	Timeout time.Duration
+
+	Retry          RetryPolicy
+	CircuitBreaker CircuitBreakerConfig
+}
+
+func (c *Config) certMode() bool {
+	return c.AppPublicCert != "" || c.AlipayPublicCert != "" || c.AlipayRootCert != ""
 }
 
 func NewClient(config *Config) (*AlipayClient, error) {
@@ -38,24 +77,49 @@ func NewClient(config *Config) (*AlipayClient, error) {
 		return nil, fmt.Errorf("parse private key failed: %w", err)
 	}
 
-	alipayPublicKey, err := parsePublicKey(config.AlipayPublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("parse alipay public key failed: %w", err)
-	}
-
 	gatewayUrl := ProdUrl
 	if config.IsSandbox {
 		gatewayUrl = SandBoxUrl
 	}
+	if config.GatewayURL != "" {
+		gatewayUrl = strings.TrimSpace(config.GatewayURL)
+	}
 
-	return &AlipayClient{
-		AppId:           config.AppId,
-		PrivateKey:      privateKey,
-		AlipayPublicKey: alipayPublicKey,
-		GatewayUrl:      gatewayUrl,
-		NotifyURL:       strings.TrimSpace(config.NotifyURL),
-		ReturnURL:       strings.TrimSpace(config.ReturnURL),
-	}, nil
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		timeout := config.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		httpClient = &http.Client{Transport: config.Transport, Timeout: timeout}
+	}
+
+	client := &AlipayClient{
+		AppId:      config.AppId,
+		SellerId:   strings.TrimSpace(config.SellerId),
+		PrivateKey: privateKey,
+		GatewayUrl: gatewayUrl,
+		NotifyURL:  strings.TrimSpace(config.NotifyURL),
+		ReturnURL:  strings.TrimSpace(config.ReturnURL),
+		httpClient: httpClient,
+		retry:      config.Retry.withDefaults(),
+		breaker:    newCircuitBreaker(config.CircuitBreaker),
+	}
+
+	if config.certMode() {
+		if err := client.loadCerts(config); err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	alipayPublicKey, err := parsePublicKey(config.AlipayPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse alipay public key failed: %w", err)
+	}
+	client.AlipayPublicKey = alipayPublicKey
+
+	return client, nil
 }
 
 func parsePrivateKey(privateKeyStr string) (*rsa.PrivateKey, error) {
@@ -139,6 +203,10 @@ func (c *AlipayClient) buildCommonParams(method string, bizContent string) map[s
 	if bizContent != "" {
 		params["biz_content"] = bizContent
 	}
+	if c.AppCertSN != "" {
+		params["app_cert_sn"] = c.AppCertSN
+		params["alipay_root_cert_sn"] = c.AlipayRootCertSN
+	}
 	return params
 }
 
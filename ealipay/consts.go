@@ -1,5 +1,7 @@
 package ealipay
 
+import "time"
+
 const (
 	SandBoxUrl = "https://openapi-sandbox.dl.alipaydev.com/gateway.do"
 	ProdUrl    = "https://openapi.alipay.com/gateway.do"
@@ -7,4 +9,12 @@ const (
 	Charset    = "utf-8"
 	SignType   = "RSA2"
 	Version    = "1.0"
+
+	DefaultTimeout = 15 * time.Second
+)
+
+const (
+	CodeSuccess      = "10000"
+	CodeWaitBuyerPay = "10003"
+	CodeUnknownError = "20000"
 )
@@ -0,0 +1,106 @@
+package ealipay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+const (
+	SubCodeTradeNotExist    = "ACQ.TRADE_NOT_EXIST"
+	SubCodeTradeStatusError = "ACQ.TRADE_STATUS_ERROR"
+	SubCodeSystemError      = "ACQ.SYSTEM_ERROR"
+	SubCodeIspUnknownError  = "isp.unknow-error"
+	SubCodeAopUnknownError  = "aop.unknow-error"
+)
+
+// Error 是支付宝网关返回的错误：code 不为 10000 的业务响应，或非 2xx 的 HTTP 响应（此时 Code 为空）。
+type Error struct {
+	Code       string `json:"code"`
+	Msg        string `json:"msg"`
+	SubCode    string `json:"sub_code,omitempty"`
+	SubMsg     string `json:"sub_msg,omitempty"`
+	HTTPStatus int    `json:"-"`
+	// Unsigned 表示错误来自未签名的 error_response 节点，内容可能被篡改：
+	// 不算作明确的业务结果，IsTradeNotExist 等判断也不会命中
+	Unsigned bool `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("alipay http status %d: %s", e.HTTPStatus, e.Msg)
+	}
+	unsigned := ""
+	if e.Unsigned {
+		unsigned = " [unsigned]"
+	}
+	if e.SubCode != "" || e.SubMsg != "" {
+		return fmt.Sprintf("alipay error: %s %s (%s %s)%s", e.Code, e.Msg, e.SubCode, e.SubMsg, unsigned)
+	}
+	return fmt.Sprintf("alipay error: %s %s%s", e.Code, e.Msg, unsigned)
+}
+
+// IsBusiness 表示支付宝已经受理请求并给出了明确的业务结果。未签名的错误无法确认来自支付宝，不算在内。
+func (e *Error) IsBusiness() bool {
+	return e.Code != "" && !e.Unsigned
+}
+
+func (e *Error) IsSystemError() bool {
+	if e.Code == CodeUnknownError {
+		return true
+	}
+	switch e.SubCode {
+	case SubCodeSystemError, SubCodeIspUnknownError, SubCodeAopUnknownError:
+		return true
+	}
+	return false
+}
+
+func (e *Error) Retryable() bool {
+	if e.IsSystemError() {
+		return true
+	}
+	return !e.IsBusiness() && (e.HTTPStatus >= 500 || e.HTTPStatus == http.StatusTooManyRequests)
+}
+
+func AsError(err error) (*Error, bool) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+func IsTradeNotExist(err error) bool {
+	apiErr, ok := AsError(err)
+	return ok && apiErr.IsBusiness() && apiErr.SubCode == SubCodeTradeNotExist
+}
+
+func IsTradeStatusError(err error) bool {
+	apiErr, ok := AsError(err)
+	return ok && apiErr.IsBusiness() && apiErr.SubCode == SubCodeTradeStatusError
+}
+
+func IsSystemError(err error) bool {
+	apiErr, ok := AsError(err)
+	return ok && apiErr.IsSystemError()
+}
+
+// IsRetryable 判断错误是否是暂时性的：支付宝系统繁忙、网关 5xx、网络错误或请求超时。
+// http.Client.Timeout 触发的超时同样满足 errors.Is(err, context.DeadlineExceeded)，
+// 无法与调用方 context 到期区分，调用方是否已经放弃应由 ctx.Err() 判断。
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apiErr, ok := AsError(err); ok {
+		return apiErr.Retryable()
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,48 @@
+package ealipay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"isp unknown error", &Error{Code: "40004", Msg: "Business Failed", SubCode: SubCodeIspUnknownError}, true},
+		{"acq system error", &Error{Code: "40004", Msg: "Business Failed", SubCode: SubCodeSystemError}, true},
+		{"unknown error code", &Error{Code: CodeUnknownError, Msg: "Service Currently Unavailable"}, true},
+		{"trade not exist", &Error{Code: "40004", Msg: "Business Failed", SubCode: SubCodeTradeNotExist}, false},
+		{"invalid parameter", &Error{Code: "40002", Msg: "Invalid Arguments", SubCode: "isv.invalid-parameter"}, false},
+		{"http 502", &Error{HTTPStatus: http.StatusBadGateway}, true},
+		{"http 429", &Error{HTTPStatus: http.StatusTooManyRequests}, true},
+		{"http 400", &Error{HTTPStatus: http.StatusBadRequest}, false},
+		{"wrapped api error", fmt.Errorf("query: %w", &Error{Code: "40004", SubCode: SubCodeSystemError}), true},
+		{"net timeout", &url.Error{Op: "Post", URL: "https://openapi.alipay.com/gateway.do", Err: timeoutError{}}, true},
+		{"client timeout", &url.Error{Op: "Post", URL: "https://openapi.alipay.com/gateway.do", Err: fmt.Errorf("%w (Client.Timeout exceeded while awaiting headers)", context.DeadlineExceeded)}, true},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"cancelled", context.Canceled, false},
+		{"cancelled request", &url.Error{Op: "Post", URL: "https://openapi.alipay.com/gateway.do", Err: context.Canceled}, false},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package ealipay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrAppIDMismatch = errors.New("notification app_id mismatch")
+
+// 支付宝通知中的时间均为北京时间
+var beijing = time.FixedZone("CST", 8*3600)
+
+type FundBill struct {
+	FundChannel string `json:"fundChannel"`
+	Amount      Amount `json:"amount"`
+	RealAmount  Amount `json:"realAmount,omitempty"`
+}
+
+// Notification 是已验签的异步通知，字段对应支付宝通知文档中的参数。
+type Notification struct {
+	NotifyTime   time.Time
+	NotifyType   string
+	NotifyID     string
+	AppID        string
+	AuthAppID    string
+	Charset      string
+	Version      string
+	SignType     string
+	Sign         string
+	TradeNo      string
+	OutTradeNo   string
+	OutBizNo     string
+	BuyerID      string
+	BuyerLogonID string
+	SellerID     string
+	SellerEmail  string
+	TradeStatus  string
+	Subject      string
+	Body         string
+
+	TotalAmount    Amount
+	ReceiptAmount  Amount
+	InvoiceAmount  Amount
+	BuyerPayAmount Amount
+	PointAmount    Amount
+	RefundFee      Amount
+
+	GmtCreate  time.Time
+	GmtPayment time.Time
+	GmtRefund  time.Time
+	GmtClose   time.Time
+
+	FundBillList   []FundBill
+	PassbackParams string
+
+	// Params 是验签通过的原始参数
+	Params map[string]string
+}
+
+// ParseNotification 解析并校验支付宝异步通知：验证签名、校验 app_id 属于当前应用，
+// 再把参数解码为类型化的 Notification。解析后 r.Form 中保留原始参数，便于记录日志。
+func (c *AlipayClient) ParseNotification(r *http.Request) (*Notification, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("parse form: %w", err)
+	}
+	return c.verifyNotification(r.Context(), NotificationParams(r.Form))
+}
+
+// NotificationParams 把表单参数展开为单值 map，重复的参数以逗号连接。
+func NotificationParams(form url.Values) map[string]string {
+	params := make(map[string]string, len(form))
+	for k, vs := range form {
+		if len(vs) == 0 {
+			continue
+		}
+		params[k] = strings.Join(vs, ",")
+	}
+	return params
+}
+
+func (c *AlipayClient) VerifyNotification(params map[string]string) (*Notification, error) {
+	return c.verifyNotification(context.Background(), params)
+}
+
+func (c *AlipayClient) verifyNotification(ctx context.Context, params map[string]string) (*Notification, error) {
+	if err := c.verifySign(ctx, params, params["sign"]); err != nil {
+		return nil, err
+	}
+	if params["app_id"] != c.AppId {
+		return nil, fmt.Errorf("%w: got %s", ErrAppIDMismatch, params["app_id"])
+	}
+	return decodeNotification(params)
+}
+
+func decodeNotification(params map[string]string) (*Notification, error) {
+	n := &Notification{
+		NotifyType:   params["notify_type"],
+		NotifyID:     params["notify_id"],
+		AppID:        params["app_id"],
+		AuthAppID:    params["auth_app_id"],
+		Charset:      params["charset"],
+		Version:      params["version"],
+		SignType:     params["sign_type"],
+		Sign:         params["sign"],
+		TradeNo:      params["trade_no"],
+		OutTradeNo:   params["out_trade_no"],
+		OutBizNo:     params["out_biz_no"],
+		BuyerID:      params["buyer_id"],
+		BuyerLogonID: params["buyer_logon_id"],
+		SellerID:     params["seller_id"],
+		SellerEmail:  params["seller_email"],
+		TradeStatus:  params["trade_status"],
+		Subject:      params["subject"],
+		Body:         params["body"],
+		Params:       params,
+	}
+
+	var err error
+	amounts := []struct {
+		key string
+		dst *Amount
+	}{
+		{"total_amount", &n.TotalAmount},
+		{"receipt_amount", &n.ReceiptAmount},
+		{"invoice_amount", &n.InvoiceAmount},
+		{"buyer_pay_amount", &n.BuyerPayAmount},
+		{"point_amount", &n.PointAmount},
+		{"refund_fee", &n.RefundFee},
+	}
+	for _, a := range amounts {
+		if v := params[a.key]; v != "" {
+			if *a.dst, err = ParseAmount(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", a.key, err)
+			}
+		}
+	}
+
+	times := []struct {
+		key string
+		dst *time.Time
+	}{
+		{"notify_time", &n.NotifyTime},
+		{"gmt_create", &n.GmtCreate},
+		{"gmt_payment", &n.GmtPayment},
+		{"gmt_refund", &n.GmtRefund},
+		{"gmt_close", &n.GmtClose},
+	}
+	for _, t := range times {
+		if v := params[t.key]; v != "" {
+			if *t.dst, err = ParseTime(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", t.key, err)
+			}
+		}
+	}
+
+	if v := params["fund_bill_list"]; v != "" {
+		// 部分历史通知中的 fund_bill_list 使用 HTML 转义的引号
+		v = strings.ReplaceAll(v, "&quot;", `"`)
+		if err := json.Unmarshal([]byte(v), &n.FundBillList); err != nil {
+			return nil, fmt.Errorf("fund_bill_list: %w", err)
+		}
+	}
+
+	if v := params["passback_params"]; v != "" {
+		n.PassbackParams = v
+		if decoded, err := url.QueryUnescape(v); err == nil {
+			n.PassbackParams = decoded
+		}
+	}
+
+	return n, nil
+}
+
+// FormatTime 把时间格式化为支付宝接口使用的北京时间。下单时传绝对的 time_expire，
+// 支付宝以它为准关闭交易，本地订单的过期时间因此与支付宝一致。
+func FormatTime(t time.Time) string {
+	return t.In(beijing).Format(time.DateTime)
+}
+
+// ParseTime 解析支付宝接口返回的北京时间，如 gmt_payment、send_pay_date。
+func ParseTime(v string) (time.Time, error) {
+	layout := time.DateTime
+	if strings.Contains(v, ".") {
+		layout = "2006-01-02 15:04:05.000"
+	}
+	return time.ParseInLocation(layout, v, beijing)
+}
@@ -6,6 +6,7 @@ type PagePayRequest struct {
 	Subject        string `json:"subject"`
 	Body           string `json:"body,omitempty"`
 	TimeoutExpress string `json:"timeout_express,omitempty"`
+	TimeExpire     string `json:"time_expire,omitempty"`
 	ProductCode    string `json:"product_code"`
 }
 
@@ -21,7 +22,7 @@ func (c *AlipayClient) PagePay(req *PagePayRequest) (string, error) {
 		req.ProductCode = "FAST_INSTANT_TRADE_PAY"
 	}
 
-	if req.TimeoutExpress == "" {
+	if req.TimeoutExpress == "" && req.TimeExpire == "" {
 		req.TimeoutExpress = "30m"
 	}
 
@@ -0,0 +1,105 @@
+package ealipay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Execute 调用任意支付宝 OpenAPI 方法：构造公共参数并签名，提交到网关，定位并验签
+// <method>_response 节点，将其解码到 out。code 不为 10000 时 out 仍会被填充，并返回 *Error。
+// 查询、关单、撤销、退款等幂等接口在网络错误或支付宝系统繁忙时会按 RetryPolicy 自动重试。
+func (c *AlipayClient) Execute(ctx context.Context, method string, biz any, out any) error {
+	raw, err := c.doRequestWithRetry(ctx, method, biz)
+	if raw != nil && out != nil {
+		if decodeErr := json.Unmarshal(raw, out); decodeErr != nil {
+			return decodeErr
+		}
+	}
+	return err
+}
+
+func responseCode(raw json.RawMessage) error {
+	var head Error
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return err
+	}
+	if head.Code != CodeSuccess {
+		head.HTTPStatus = http.StatusOK
+		return &head
+	}
+	return nil
+}
+
+// executeAs 在业务错误时同时返回响应和 *Error，其他错误时响应为 nil，
+// 调用方据此区分“支付宝明确拒绝”和“结果未知”。
+func executeAs[T any](ctx context.Context, c *AlipayClient, method string, biz any) (*T, error) {
+	var out T
+	if err := c.Execute(ctx, method, biz, &out); err != nil {
+		if apiErr, ok := AsError(err); ok && apiErr.IsBusiness() {
+			return &out, err
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *AlipayClient) doRequest(ctx context.Context, method string, bizContent any) (json.RawMessage, error) {
+	bizContentStr, err := c.buildBizContent(bizContent)
+	if err != nil {
+		return nil, err
+	}
+
+	params := c.buildCommonParams(method, bizContentStr)
+	params["timestamp"] = getCurrentTimestamp()
+
+	sign, err := c.generateSign(params)
+	if err != nil {
+		return nil, err
+	}
+	params["sign"] = sign
+
+	form := url.Values{}
+	for k, v := range params {
+		form.Set(k, v)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.GatewayUrl, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &Error{HTTPStatus: resp.StatusCode, Msg: string(body)}
+	}
+
+	responseKey := strings.ReplaceAll(method, ".", "_") + "_response"
+	if method == certDownloadMethod {
+		// 下载的新证书由根证书校验，响应本身可能由尚未缓存的新证书签名
+		node, err := extractResponse(body, responseKey)
+		if err != nil {
+			return nil, err
+		}
+		return node.Raw, nil
+	}
+	return c.verifyResponse(ctx, body, responseKey)
+}
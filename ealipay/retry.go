@@ -0,0 +1,154 @@
+package ealipay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("alipay circuit breaker is open")
+
+// idempotentMethods 是重复提交不会产生额外副作用的接口：查询类接口，以及以
+// out_trade_no / out_request_no 去重的关单、撤销、退款。
+var idempotentMethods = map[string]bool{
+	"alipay.trade.query":                true,
+	"alipay.trade.fastpay.refund.query": true,
+	"alipay.trade.close":                true,
+	"alipay.trade.cancel":               true,
+	"alipay.trade.refund":               true,
+	billDownloadURLQueryMethod:          true,
+	certDownloadMethod:                  true,
+}
+
+type RetryPolicy struct {
+	// MaxAttempts 包含首次请求，默认 3，设为 1 关闭重试
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 200 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 2 * time.Second
+	}
+	return p
+}
+
+// backoff 返回第 attempt 次失败后的等待时间：指数增长并在 [d/2, d) 之间随机抖动。
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+type CircuitBreakerConfig struct {
+	// FailureThreshold 是连续暂时性失败多少次后熔断，默认 5，设为负数关闭熔断
+	FailureThreshold int
+	// OpenTimeout 是熔断后多久放行一次试探请求，默认 30s
+	OpenTimeout time.Duration
+}
+
+type circuitBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	if cfg.FailureThreshold < 0 {
+		return nil
+	}
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	return &circuitBreaker{threshold: cfg.FailureThreshold, openTimeout: cfg.OpenTimeout}
+}
+
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.openTimeout {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// record 只把暂时性失败（包括网关超时）计入熔断；业务错误说明网关本身是健康的。
+// 调用方 ctx 已经取消或到期的请求不影响计数，这只能由 ctx.Err() 判断：
+// http.Client.Timeout 触发的超时同样满足 errors.Is(err, context.DeadlineExceeded)。
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if ctx.Err() != nil {
+		return
+	}
+	if !IsRetryable(err) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+func (c *AlipayClient) doRequestWithRetry(ctx context.Context, method string, biz any) (json.RawMessage, error) {
+	maxAttempts := 1
+	if idempotentMethods[method] {
+		maxAttempts = c.retry.withDefaults().MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := c.breaker.allow(); err != nil {
+			return nil, err
+		}
+
+		raw, err := c.doRequest(ctx, method, biz)
+		if err == nil {
+			err = responseCode(raw)
+		}
+		c.breaker.record(ctx, err)
+		if ctx.Err() != nil || !IsRetryable(err) || attempt >= maxAttempts {
+			return raw, err
+		}
+
+		timer := time.NewTimer(c.retry.withDefaults().backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return raw, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package ealipay_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pay/ealipay"
+	"pay/ealipay/alipaytest"
+)
+
+// newSlowGatewayClient 返回指向一个从不及时响应的网关的客户端，以及该网关收到的请求数。
+func newSlowGatewayClient(t *testing.T, timeout time.Duration, retry ealipay.RetryPolicy, breaker ealipay.CircuitBreakerConfig) (*ealipay.AlipayClient, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+
+	srv := alipaytest.NewServer()
+	t.Cleanup(srv.Close)
+	cfg := srv.Config()
+	cfg.GatewayURL = slow.URL
+	cfg.Timeout = timeout
+	cfg.Retry = retry
+	cfg.CircuitBreaker = breaker
+	client, err := ealipay.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, &hits
+}
+
+func TestGatewayTimeoutIsRetried(t *testing.T) {
+	client, hits := newSlowGatewayClient(t, 50*time.Millisecond,
+		ealipay.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		ealipay.CircuitBreakerConfig{FailureThreshold: -1})
+
+	_, err := client.TradeQueryContext(context.Background(), &ealipay.TradeQueryRequest{OutTradeNo: "T1"})
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if !ealipay.IsRetryable(err) {
+		t.Errorf("IsRetryable(%v) = false, want true", err)
+	}
+	if got := hits.Load(); got != 3 {
+		t.Errorf("gateway hits = %d, want 3", got)
+	}
+}
+
+func TestGatewayTimeoutOpensCircuit(t *testing.T) {
+	client, hits := newSlowGatewayClient(t, 50*time.Millisecond,
+		ealipay.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		ealipay.CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+
+	_, err := client.TradeQueryContext(context.Background(), &ealipay.TradeQueryRequest{OutTradeNo: "T1"})
+	if !errors.Is(err, ealipay.ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen after two timeouts", err)
+	}
+	_, err = client.TradeQueryContext(context.Background(), &ealipay.TradeQueryRequest{OutTradeNo: "T1"})
+	if !errors.Is(err, ealipay.ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("gateway hits = %d, want 2", got)
+	}
+}
+
+func TestCallerDeadlineIsNotRetriedOrCounted(t *testing.T) {
+	client, hits := newSlowGatewayClient(t, time.Second,
+		ealipay.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		ealipay.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := client.TradeQueryContext(ctx, &ealipay.TradeQueryRequest{OutTradeNo: "T1"})
+		cancel()
+		if err == nil || errors.Is(err, ealipay.ErrCircuitOpen) {
+			t.Fatalf("call %d: err = %v, want caller deadline error", i, err)
+		}
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("gateway hits = %d, want 2 (one per call, breaker closed)", got)
+	}
+}
@@ -0,0 +1,44 @@
+package ealipay
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	CancelActionClose    = "close"
+	CancelActionRefund   = "refund"
+	CancelActionNoRefund = "no_refund"
+)
+
+type TradeCancelRequest struct {
+	OutTradeNo string `json:"out_trade_no,omitempty"`
+	TradeNo    string `json:"trade_no,omitempty"`
+}
+
+type TradeCancelResponse struct {
+	Code               string `json:"code"`
+	Msg                string `json:"msg"`
+	SubCode            string `json:"sub_code,omitempty"`
+	SubMsg             string `json:"sub_msg,omitempty"`
+	TradeNo            string `json:"trade_no,omitempty"`
+	OutTradeNo         string `json:"out_trade_no,omitempty"`
+	RetryFlag          string `json:"retry_flag,omitempty"`
+	Action             string `json:"action,omitempty"`
+	GmtRefundPay       string `json:"gmt_refund_pay,omitempty"`
+	RefundSettlementId string `json:"refund_settlement_id,omitempty"`
+}
+
+// TradeCancel 撤销交易，用于支付结果未知的场景：未支付的交易会被关闭，已支付的交易会原路退款。
+// 返回 retry_flag 为 Y 时需要使用相同参数重试。
+func (c *AlipayClient) TradeCancel(req *TradeCancelRequest) (*TradeCancelResponse, error) {
+	return c.TradeCancelContext(context.Background(), req)
+}
+
+func (c *AlipayClient) TradeCancelContext(ctx context.Context, req *TradeCancelRequest) (*TradeCancelResponse, error) {
+	if req == nil || (req.OutTradeNo == "" && req.TradeNo == "") {
+		return nil, fmt.Errorf("out_trade_no or trade_no is required")
+	}
+
+	return executeAs[TradeCancelResponse](ctx, c, "alipay.trade.cancel", req)
+}
@@ -0,0 +1,33 @@
+package ealipay
+
+import (
+	"context"
+	"fmt"
+)
+
+type TradeCloseRequest struct {
+	OutTradeNo string `json:"out_trade_no,omitempty"`
+	TradeNo    string `json:"trade_no,omitempty"`
+	OperatorId string `json:"operator_id,omitempty"`
+}
+
+type TradeCloseResponse struct {
+	Code       string `json:"code"`
+	Msg        string `json:"msg"`
+	SubCode    string `json:"sub_code,omitempty"`
+	SubMsg     string `json:"sub_msg,omitempty"`
+	TradeNo    string `json:"trade_no,omitempty"`
+	OutTradeNo string `json:"out_trade_no,omitempty"`
+}
+
+func (c *AlipayClient) TradeClose(req *TradeCloseRequest) (*TradeCloseResponse, error) {
+	return c.TradeCloseContext(context.Background(), req)
+}
+
+func (c *AlipayClient) TradeCloseContext(ctx context.Context, req *TradeCloseRequest) (*TradeCloseResponse, error) {
+	if req == nil || (req.OutTradeNo == "" && req.TradeNo == "") {
+		return nil, fmt.Errorf("out_trade_no or trade_no is required")
+	}
+
+	return executeAs[TradeCloseResponse](ctx, c, "alipay.trade.close", req)
+}
@@ -0,0 +1,60 @@
+package ealipay
+
+import (
+	"context"
+	"fmt"
+)
+
+type TradePayRequest struct {
+	OutTradeNo     string `json:"out_trade_no"`
+	Scene          string `json:"scene"`
+	AuthCode       string `json:"auth_code"`
+	TotalAmount    string `json:"total_amount"`
+	Subject        string `json:"subject"`
+	Body           string `json:"body,omitempty"`
+	TimeoutExpress string `json:"timeout_express,omitempty"`
+	ProductCode    string `json:"product_code,omitempty"`
+	StoreId        string `json:"store_id,omitempty"`
+	TerminalId     string `json:"terminal_id,omitempty"`
+}
+
+type TradePayResponse struct {
+	Code          string `json:"code"`
+	Msg           string `json:"msg"`
+	SubCode       string `json:"sub_code,omitempty"`
+	SubMsg        string `json:"sub_msg,omitempty"`
+	TradeNo       string `json:"trade_no,omitempty"`
+	OutTradeNo    string `json:"out_trade_no,omitempty"`
+	BuyerLogonId  string `json:"buyer_logon_id,omitempty"`
+	BuyerUserId   string `json:"buyer_user_id,omitempty"`
+	TotalAmount   string `json:"total_amount,omitempty"`
+	ReceiptAmount string `json:"receipt_amount,omitempty"`
+	GmtPayment    string `json:"gmt_payment,omitempty"`
+}
+
+// TradePay 统一收单交易支付（付款码支付）。返回 10003 表示等待买家输入密码，
+// 此时不返回 error，调用方需要轮询 TradeQuery，超时后调用 TradeCancel。
+func (c *AlipayClient) TradePay(req *TradePayRequest) (*TradePayResponse, error) {
+	return c.TradePayContext(context.Background(), req)
+}
+
+func (c *AlipayClient) TradePayContext(ctx context.Context, req *TradePayRequest) (*TradePayResponse, error) {
+	if req == nil || req.OutTradeNo == "" {
+		return nil, fmt.Errorf("out_trade_no is required")
+	}
+	if req.AuthCode == "" {
+		return nil, fmt.Errorf("auth_code is required")
+	}
+	if req.Scene == "" {
+		req.Scene = "bar_code"
+	}
+	if req.ProductCode == "" {
+		req.ProductCode = "FACE_TO_FACE_PAYMENT"
+	}
+
+	out, err := executeAs[TradePayResponse](ctx, c, "alipay.trade.pay", req)
+	if err != nil && out != nil && out.Code == CodeWaitBuyerPay {
+		return out, nil
+	}
+	return out, err
+}
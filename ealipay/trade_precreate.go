@@ -0,0 +1,46 @@
+package ealipay
+
+import (
+	"context"
+	"fmt"
+)
+
+type TradePrecreateRequest struct {
+	OutTradeNo     string `json:"out_trade_no"`
+	TotalAmount    string `json:"total_amount"`
+	Subject        string `json:"subject"`
+	Body           string `json:"body,omitempty"`
+	TimeoutExpress string `json:"timeout_express,omitempty"`
+	TimeExpire     string `json:"time_expire,omitempty"`
+	ProductCode    string `json:"product_code,omitempty"`
+	StoreId        string `json:"store_id,omitempty"`
+	TerminalId     string `json:"terminal_id,omitempty"`
+}
+
+type TradePrecreateResponse struct {
+	Code       string `json:"code"`
+	Msg        string `json:"msg"`
+	SubCode    string `json:"sub_code,omitempty"`
+	SubMsg     string `json:"sub_msg,omitempty"`
+	OutTradeNo string `json:"out_trade_no,omitempty"`
+	QrCode     string `json:"qr_code,omitempty"`
+}
+
+// TradePrecreate 当面付预下单，返回的 qr_code 是支付宝 App 可直接扫描的短链接。
+func (c *AlipayClient) TradePrecreate(req *TradePrecreateRequest) (*TradePrecreateResponse, error) {
+	return c.TradePrecreateContext(context.Background(), req)
+}
+
+func (c *AlipayClient) TradePrecreateContext(ctx context.Context, req *TradePrecreateRequest) (*TradePrecreateResponse, error) {
+	if req == nil || req.OutTradeNo == "" {
+		return nil, fmt.Errorf("out_trade_no is required")
+	}
+	if req.ProductCode == "" {
+		req.ProductCode = "FACE_TO_FACE_PAYMENT"
+	}
+	if req.TimeoutExpress == "" && req.TimeExpire == "" {
+		req.TimeoutExpress = "30m"
+	}
+
+	return executeAs[TradePrecreateResponse](ctx, c, "alipay.trade.precreate", req)
+}
@@ -0,0 +1,44 @@
+package ealipay
+
+import (
+	"context"
+	"fmt"
+)
+
+type TradeRefundRequest struct {
+	OutTradeNo   string `json:"out_trade_no,omitempty"`
+	TradeNo      string `json:"trade_no,omitempty"`
+	RefundAmount string `json:"refund_amount"`
+	RefundReason string `json:"refund_reason,omitempty"`
+	OutRequestNo string `json:"out_request_no,omitempty"`
+}
+
+type TradeRefundResponse struct {
+	Code         string `json:"code"`
+	Msg          string `json:"msg"`
+	SubCode      string `json:"sub_code,omitempty"`
+	SubMsg       string `json:"sub_msg,omitempty"`
+	TradeNo      string `json:"trade_no,omitempty"`
+	OutTradeNo   string `json:"out_trade_no,omitempty"`
+	BuyerLogonId string `json:"buyer_logon_id,omitempty"`
+	FundChange   string `json:"fund_change,omitempty"`
+	RefundFee    string `json:"refund_fee,omitempty"`
+	GmtRefundPay string `json:"gmt_refund_pay,omitempty"`
+}
+
+// TradeRefund 发起退款。同一笔交易多次部分退款时 out_request_no 必须不同；
+// 使用相同的 out_request_no 重试是幂等的，不会重复退款。
+func (c *AlipayClient) TradeRefund(req *TradeRefundRequest) (*TradeRefundResponse, error) {
+	return c.TradeRefundContext(context.Background(), req)
+}
+
+func (c *AlipayClient) TradeRefundContext(ctx context.Context, req *TradeRefundRequest) (*TradeRefundResponse, error) {
+	if req == nil || (req.OutTradeNo == "" && req.TradeNo == "") {
+		return nil, fmt.Errorf("out_trade_no or trade_no is required")
+	}
+	if req.RefundAmount == "" {
+		return nil, fmt.Errorf("refund_amount is required")
+	}
+
+	return executeAs[TradeRefundResponse](ctx, c, "alipay.trade.refund", req)
+}
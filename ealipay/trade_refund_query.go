@@ -0,0 +1,53 @@
+package ealipay
+
+import (
+	"context"
+	"fmt"
+)
+
+const RefundStatusSuccess = "REFUND_SUCCESS"
+
+type TradeRefundQueryRequest struct {
+	OutTradeNo   string   `json:"out_trade_no,omitempty"`
+	TradeNo      string   `json:"trade_no,omitempty"`
+	OutRequestNo string   `json:"out_request_no"`
+	QueryOptions []string `json:"query_options,omitempty"`
+}
+
+type TradeRefundQueryResponse struct {
+	Code         string `json:"code"`
+	Msg          string `json:"msg"`
+	SubCode      string `json:"sub_code,omitempty"`
+	SubMsg       string `json:"sub_msg,omitempty"`
+	TradeNo      string `json:"trade_no,omitempty"`
+	OutTradeNo   string `json:"out_trade_no,omitempty"`
+	OutRequestNo string `json:"out_request_no,omitempty"`
+	TotalAmount  string `json:"total_amount,omitempty"`
+	RefundAmount string `json:"refund_amount,omitempty"`
+	RefundStatus string `json:"refund_status,omitempty"`
+	GmtRefundPay string `json:"gmt_refund_pay,omitempty"`
+}
+
+// Refunded 按支付宝约定判断退款是否成功：查询到退款数据且 refund_status 为空或 REFUND_SUCCESS。
+// 未查询到数据表示该笔退款未成功，可以使用同一个 out_request_no 重新发起退款。
+func (r *TradeRefundQueryResponse) Refunded() bool {
+	if r == nil || r.RefundAmount == "" {
+		return false
+	}
+	return r.RefundStatus == "" || r.RefundStatus == RefundStatusSuccess
+}
+
+func (c *AlipayClient) TradeRefundQuery(req *TradeRefundQueryRequest) (*TradeRefundQueryResponse, error) {
+	return c.TradeRefundQueryContext(context.Background(), req)
+}
+
+func (c *AlipayClient) TradeRefundQueryContext(ctx context.Context, req *TradeRefundQueryRequest) (*TradeRefundQueryResponse, error) {
+	if req == nil || (req.OutTradeNo == "" && req.TradeNo == "") {
+		return nil, fmt.Errorf("out_trade_no or trade_no is required")
+	}
+	if req.OutRequestNo == "" {
+		return nil, fmt.Errorf("out_request_no is required")
+	}
+
+	return executeAs[TradeRefundQueryResponse](ctx, c, "alipay.trade.fastpay.refund.query", req)
+}
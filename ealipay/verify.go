@@ -1,19 +1,34 @@
 package ealipay
 
 import (
+	"context"
 	"crypto"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"sort"
 	"strings"
 )
 
+// ErrUnsignedResponse 表示 <method>_response 节点没有签名，内容不可信。
+var ErrUnsignedResponse = errors.New("alipay response is not signed")
+
 func (c *AlipayClient) VerifySign(params map[string]string, sign string) error {
-	if c == nil || c.AlipayPublicKey == nil {
+	return c.verifySign(context.Background(), params, sign)
+}
+
+func (c *AlipayClient) verifySign(ctx context.Context, params map[string]string, sign string) error {
+	if c == nil {
 		return fmt.Errorf("alipay public key not configured")
 	}
+	publicKey, err := c.publicKeyForCertSN(ctx, params["alipay_cert_sn"])
+	if err != nil {
+		return err
+	}
 	if sign == "" {
 		return fmt.Errorf("missing sign")
 	}
@@ -23,13 +38,97 @@ func (c *AlipayClient) VerifySign(params map[string]string, sign string) error {
 		return fmt.Errorf("empty sign content")
 	}
 
+	return verifyRSA2(publicKey, []byte(content), sign)
+}
+
+// VerifyResponse 校验同步响应的签名。支付宝对 <method>_response 节点的原始 JSON 字节签名，
+// 因此必须使用响应体中的原文，而不是解析后再序列化的结果。
+// 返回的是已验签的响应节点，网关级错误时为 error_response 节点。
+// 只有网关级的 error_response 允许不签名，此时同时返回节点和 Unsigned 的 *Error；
+// 未签名的 <method>_response 返回 ErrUnsignedResponse。
+func (c *AlipayClient) VerifyResponse(body []byte, responseKey string) (json.RawMessage, error) {
+	return c.verifyResponse(context.Background(), body, responseKey)
+}
+
+func (c *AlipayClient) verifyResponse(ctx context.Context, body []byte, responseKey string) (json.RawMessage, error) {
+	node, err := extractResponse(body, responseKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.Sign == "" {
+		// 网关对签名错误、无效 app_id 等网关级错误不签名。任何能篡改响应的人都能伪造这类节点，
+		// 因此只接受 error_response，并标记为 Unsigned，调用方不能据此修改本地状态
+		if node.Key != errorResponseKey {
+			return nil, fmt.Errorf("%s: %w", responseKey, ErrUnsignedResponse)
+		}
+		var head Error
+		if err := json.Unmarshal(node.Raw, &head); err != nil {
+			return nil, err
+		}
+		if head.Code == CodeSuccess {
+			return nil, fmt.Errorf("%s: %w", errorResponseKey, ErrUnsignedResponse)
+		}
+		head.HTTPStatus = http.StatusOK
+		head.Unsigned = true
+		return node.Raw, &head
+	}
+
+	publicKey, err := c.publicKeyForCertSN(ctx, node.CertSN)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyRSA2(publicKey, node.Raw, node.Sign); err != nil {
+		return nil, fmt.Errorf("%s: %w", node.Key, err)
+	}
+	return node.Raw, nil
+}
+
+const errorResponseKey = "error_response"
+
+// responseNode 是从响应体中取出的响应节点，Key 为 <method>_response 或 error_response。
+type responseNode struct {
+	Key    string
+	Raw    json.RawMessage
+	Sign   string
+	CertSN string
+}
+
+func extractResponse(body []byte, responseKey string) (*responseNode, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+
+	node := &responseNode{Key: responseKey, Raw: envelope[responseKey]}
+	if len(node.Raw) == 0 {
+		node.Key, node.Raw = errorResponseKey, envelope[errorResponseKey]
+	}
+	if len(node.Raw) == 0 {
+		return nil, fmt.Errorf("missing %s: %s", responseKey, string(body))
+	}
+
+	if v, ok := envelope["sign"]; ok {
+		if err := json.Unmarshal(v, &node.Sign); err != nil {
+			return nil, fmt.Errorf("invalid sign: %w", err)
+		}
+	}
+	if v, ok := envelope["alipay_cert_sn"]; ok {
+		if err := json.Unmarshal(v, &node.CertSN); err != nil {
+			return nil, fmt.Errorf("invalid alipay_cert_sn: %w", err)
+		}
+	}
+	return node, nil
+}
+
+func verifyRSA2(publicKey *rsa.PublicKey, content []byte, sign string) error {
 	sig, err := base64.StdEncoding.DecodeString(sign)
 	if err != nil {
 		return fmt.Errorf("decode sign: %w", err)
 	}
 
-	sum := sha256.Sum256([]byte(content))
-	if err := rsa.VerifyPKCS1v15(c.AlipayPublicKey, crypto.SHA256, sum[:], sig); err != nil {
+	sum := sha256.Sum256(content)
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, sum[:], sig); err != nil {
 		return fmt.Errorf("verify sign failed: %w", err)
 	}
 	return nil
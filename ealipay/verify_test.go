@@ -0,0 +1,59 @@
+package ealipay_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pay/ealipay"
+	"pay/ealipay/alipaytest"
+)
+
+func TestUnsignedResponseNotTrusted(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantUnsigned bool
+	}{
+		{"method response", `{"alipay_trade_query_response":{"code":"40004","msg":"Business Failed","sub_code":"ACQ.TRADE_NOT_EXIST","sub_msg":"交易不存在"}}`, false},
+		{"success without sign", `{"alipay_trade_query_response":{"code":"10000","msg":"Success","trade_status":"TRADE_CLOSED"}}`, false},
+		{"error_response", `{"error_response":{"code":"40004","msg":"Business Failed","sub_code":"ACQ.TRADE_NOT_EXIST","sub_msg":"交易不存在"}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer gateway.Close()
+
+			srv := alipaytest.NewServer()
+			defer srv.Close()
+			cfg := srv.Config()
+			cfg.GatewayURL = gateway.URL
+			cfg.Retry = ealipay.RetryPolicy{MaxAttempts: 1}
+			client, err := ealipay.NewClient(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.TradeQuery(&ealipay.TradeQueryRequest{OutTradeNo: "otn-unsigned"})
+			if err == nil || resp != nil {
+				t.Fatalf("TradeQuery = %+v, %v; want error without response", resp, err)
+			}
+			if ealipay.IsTradeNotExist(err) {
+				t.Fatalf("unsigned %v treated as trade not exist", err)
+			}
+			apiErr, ok := ealipay.AsError(err)
+			if tt.wantUnsigned {
+				if !ok || !apiErr.Unsigned || apiErr.IsBusiness() {
+					t.Fatalf("error = %#v, want unsigned non-business *Error", err)
+				}
+				return
+			}
+			if !errors.Is(err, ealipay.ErrUnsignedResponse) {
+				t.Fatalf("error = %v, want ErrUnsignedResponse", err)
+			}
+		})
+	}
+}
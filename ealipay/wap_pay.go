@@ -6,6 +6,7 @@ type WapPayRequest struct {
 	Subject        string `json:"subject"`
 	Body           string `json:"body,omitempty"`
 	TimeoutExpress string `json:"timeout_express,omitempty"`
+	TimeExpire     string `json:"time_expire,omitempty"`
 	ProductCode    string `json:"product_code"`
 }
 
@@ -14,7 +15,7 @@ func (c *AlipayClient) WapPay(req *WapPayRequest) (string, error) {
 		req.ProductCode = "QUICK_WAP_WAY"
 	}
 
-	if req.TimeoutExpress == "" {
+	if req.TimeoutExpress == "" && req.TimeExpire == "" {
 		req.TimeoutExpress = "30m"
 	}
 
@@ -24,8 +24,8 @@ async function createOrder() {
     try {
         let endpoint, requestData;
         
-        if (payType === 'app') {
-            endpoint = '/api/app-orders';
+        if (payType === 'wap') {
+            endpoint = '/api/wap-orders';
             requestData = {
                 total_amount: amount,
                 subject: subject,
@@ -36,7 +36,8 @@ async function createOrder() {
             requestData = {
                 total_amount: amount,
                 subject: subject,
-                body: body
+                body: body,
+                pay_type: payType === 'precreate' ? 'precreate' : 'page'
             };
         }
 
@@ -55,7 +56,7 @@ async function createOrder() {
         const data = await response.json();
         currentOrderId = data.order_id;
 
-        if (payType === 'app') {
+        if (payType === 'wap') {
             displayAppPayment(data.pay_url, data.order_id, amount);
         } else {
             displayQRCode(data.qr_code, data.order_id, amount);
@@ -216,6 +217,14 @@ function displayOrderStatus(order) {
             statusText = '订单已关闭';
             statusClass = 'closed';
             break;
+        case 'partially_refunded':
+            statusText = '部分退款';
+            statusClass = 'closed';
+            break;
+        case 'refunded':
+            statusText = '已全额退款';
+            statusClass = 'closed';
+            break;
     }
 
     statusDiv.innerHTML = `
@@ -310,6 +319,10 @@ function getStatusText(status) {
             return '支付失败';
         case 'closed':
             return '订单已关闭';
+        case 'partially_refunded':
+            return '部分退款';
+        case 'refunded':
+            return '已全额退款';
         default:
             return status;
     }
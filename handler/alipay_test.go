@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"pay/ealipay"
+	"pay/ealipay/alipaytest"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestApp 启动模拟网关和挂载了订单、退款、通知接口的应用，存储使用默认的内存实现。
+func newTestApp(t *testing.T) (*alipaytest.Server, *httptest.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.POST("/api/orders", CreateOrder)
+	r.POST("/api/orders/:id/sync", SyncOrderStatus)
+	r.POST("/api/orders/:id/cancel", CancelOrder)
+	r.POST("/api/orders/:id/refunds", CreateRefund)
+	r.POST("/api/orders/:id/refunds/:refund_id/sync", SyncRefundStatus)
+	r.POST("/api/alipay/notify", AlipayNotify)
+	app := httptest.NewServer(r)
+	t.Cleanup(app.Close)
+
+	srv := alipaytest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.NotifyURL = app.URL + "/api/alipay/notify"
+	if err := InitAlipayClient(srv.Config()); err != nil {
+		t.Fatal(err)
+	}
+	return srv, app
+}
+
+func postJSON(t *testing.T, url string, body any, out any) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			t.Fatalf("decode %s: %v", respBody, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func createTestOrder(t *testing.T, app *httptest.Server, amount, payType string) *model.Order {
+	t.Helper()
+	var created CreateOrderResponse
+	code := postJSON(t, app.URL+"/api/orders", gin.H{"total_amount": amount, "subject": "test", "pay_type": payType}, &created)
+	if code != http.StatusOK {
+		t.Fatalf("create order status = %d", code)
+	}
+	order, ok := model.Store.GetByID(created.OrderID)
+	if !ok {
+		t.Fatalf("order %s not stored", created.OrderID)
+	}
+	return order
+}
+
+func TestPrecreateNotifyMarksOrderPaid(t *testing.T) {
+	srv, app := newTestApp(t)
+
+	order := createTestOrder(t, app, "10.00", string(model.PayTypePrecreate))
+	if _, ok := srv.Trade(order.OutTradeNo); !ok {
+		t.Fatalf("precreate did not create trade %s", order.OutTradeNo)
+	}
+
+	trade, err := srv.Pay(order.OutTradeNo, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := srv.NotifyParams(order.OutTradeNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered, err := srv.NotifyParams(order.OutTradeNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered.Set("total_amount", "0.01")
+	if ack, err := srv.SendNotify(context.Background(), srv.NotifyURL, tampered); err != nil || ack != "fail" {
+		t.Fatalf("tampered notify ack = %q, %v; want fail", ack, err)
+	}
+	if got, _ := model.Store.GetByID(order.ID); got.Status != model.OrderStatusPending {
+		t.Fatalf("status after tampered notify = %s, want pending", got.Status)
+	}
+
+	// 支付宝会重复发送同一份通知，两次都应答 success 且只流转一次
+	for i := 0; i < 2; i++ {
+		ack, err := srv.SendNotify(context.Background(), srv.NotifyURL, values)
+		if err != nil || ack != "success" {
+			t.Fatalf("notify #%d ack = %q, %v; want success", i+1, ack, err)
+		}
+	}
+
+	got, _ := model.Store.GetByID(order.ID)
+	if got.Status != model.OrderStatusPaid || got.TradeNo != trade.TradeNo {
+		t.Fatalf("order = %s %s, want paid %s", got.Status, got.TradeNo, trade.TradeNo)
+	}
+	if got.GmtPayment == nil || !got.GmtPayment.Equal(trade.GmtPayment.Truncate(time.Second)) {
+		t.Fatalf("gmt_payment = %v, want %v", got.GmtPayment, trade.GmtPayment)
+	}
+	paid := 0
+	for _, h := range model.Store.ListStatusHistory(order.ID) {
+		if h.ToStatus == model.OrderStatusPaid {
+			paid++
+			if h.Source != model.TransitionSourceNotify {
+				t.Fatalf("paid transition source = %s, want notify", h.Source)
+			}
+		}
+	}
+	if paid != 1 {
+		t.Fatalf("paid transitions = %d, want 1", paid)
+	}
+}
+
+func TestSyncOrderStatusAndRefund(t *testing.T) {
+	srv, app := newTestApp(t)
+
+	order := createTestOrder(t, app, "10.00", string(model.PayTypePage))
+
+	// 电脑网站支付的交易在买家付款前不存在
+	var synced struct {
+		Order *model.Order `json:"order"`
+	}
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/sync", nil, &synced); code != http.StatusOK {
+		t.Fatalf("sync before pay status = %d", code)
+	}
+	if synced.Order.Status != model.OrderStatusPending {
+		t.Fatalf("status before pay = %s, want pending", synced.Order.Status)
+	}
+
+	if _, err := srv.Pay(order.OutTradeNo, "10.00"); err != nil {
+		t.Fatal(err)
+	}
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/sync", nil, &synced); code != http.StatusOK {
+		t.Fatalf("sync after pay status = %d", code)
+	}
+	if synced.Order.Status != model.OrderStatusPaid {
+		t.Fatalf("status after pay = %s, want paid", synced.Order.Status)
+	}
+
+	var refund model.Refund
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds", gin.H{"refund_amount": "3.00"}, &refund); code != http.StatusOK {
+		t.Fatalf("refund status = %d", code)
+	}
+	if refund.Status != model.RefundStatusSuccess || refund.RefundAmount != 300 {
+		t.Fatalf("refund = %s %s, want success 3.00", refund.Status, refund.RefundAmount)
+	}
+	if got, _ := model.Store.GetByID(order.ID); got.Status != model.OrderStatusPartiallyRefunded {
+		t.Fatalf("status after partial refund = %s, want partially_refunded", got.Status)
+	}
+	if trade, _ := srv.Trade(order.OutTradeNo); trade.RefundedFee != 300 {
+		t.Fatalf("gateway refunded fee = %d, want 300", trade.RefundedFee)
+	}
+
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds", gin.H{"refund_amount": "8.00"}, nil); code != http.StatusBadRequest {
+		t.Fatalf("over refund status = %d, want 400", code)
+	}
+
+	var refundSync struct {
+		Refund *model.Refund `json:"refund"`
+	}
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds/"+refund.ID+"/sync", nil, &refundSync); code != http.StatusOK {
+		t.Fatalf("refund sync status = %d", code)
+	}
+	if refundSync.Refund == nil || refundSync.Refund.Status != model.RefundStatusSuccess {
+		t.Fatalf("synced refund = %+v, want success", refundSync.Refund)
+	}
+
+	// 重复同步已成功的退款不会再写 refund.succeeded
+	if n := countOrderEvents(order.ID, model.RefundEventSucceeded); n != 1 {
+		t.Fatalf("refund.succeeded events = %d, want 1", n)
+	}
+
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds", gin.H{"refund_amount": "7.00"}, &refund); code != http.StatusOK {
+		t.Fatalf("final refund status = %d", code)
+	}
+	if got, _ := model.Store.GetByID(order.ID); got.Status != model.OrderStatusRefunded {
+		t.Fatalf("status after full refund = %s, want refunded", got.Status)
+	}
+	if n := countOrderEvents(order.ID, model.RefundEventSucceeded); n != 2 {
+		t.Fatalf("refund.succeeded events = %d, want 2", n)
+	}
+}
+
+func countOrderEvents(orderID, eventType string) int {
+	n := 0
+	for _, e := range model.OrderEvents.ListByOrderID(orderID) {
+		if e.EventType == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCancelOrderKeepsPendingUntilPayLinkExpires(t *testing.T) {
+	srv, app := newTestApp(t)
+
+	var created CreateOrderResponse
+	if code := postJSON(t, app.URL+"/api/orders", gin.H{"total_amount": "1.00", "subject": "test"}, &created); code != http.StatusOK {
+		t.Fatalf("create order status = %d", code)
+	}
+	order, _ := model.Store.GetByID(created.OrderID)
+
+	payURL, err := url.Parse(created.QrCodeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var biz map[string]string
+	if err := json.Unmarshal([]byte(payURL.Query().Get("biz_content")), &biz); err != nil {
+		t.Fatal(err)
+	}
+	if want := ealipay.FormatTime(order.ExpiresAt); biz["time_expire"] != want {
+		t.Fatalf("time_expire = %q, want %q", biz["time_expire"], want)
+	}
+
+	// 买家还没打开支付链接，支付宝查不到交易，但链接仍然可以付款
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/cancel", nil, nil); code != http.StatusConflict {
+		t.Fatalf("cancel before expiry status = %d, want 409", code)
+	}
+	if got, _ := model.Store.GetByID(order.ID); got.Status != model.OrderStatusPending {
+		t.Fatalf("status after early cancel = %s, want pending", got.Status)
+	}
+
+	// 支付链接过期并超过宽限期的订单可以只关闭本地订单
+	order = &model.Order{
+		OutTradeNo:  generateOutTradeNo(),
+		TotalAmount: 100,
+		Subject:     "test",
+		PayType:     model.PayTypePage,
+		ExpiresAt:   time.Now().Add(-model.OrderExpireGrace - time.Minute),
+	}
+	if err := model.Store.Create(order); err != nil {
+		t.Fatal(err)
+	}
+	var cancelled struct {
+		Order  *model.Order `json:"order"`
+		Action string       `json:"action"`
+	}
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/cancel", nil, &cancelled); code != http.StatusOK {
+		t.Fatalf("cancel after expiry status = %d", code)
+	}
+	if cancelled.Action != "local_close" || cancelled.Order.Status != model.OrderStatusClosed {
+		t.Fatalf("cancel = %s %s, want local_close closed", cancelled.Action, cancelled.Order.Status)
+	}
+	if _, ok := srv.Trade(order.OutTradeNo); ok {
+		t.Fatal("gateway has a trade for an unpaid page order")
+	}
+}
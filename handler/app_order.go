@@ -3,63 +3,69 @@ package handler
 import (
 	"net/http"
 	"pay/ealipay"
+	"pay/logging"
 	"pay/model"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 type CreateAppOrderRequest struct {
-	TotalAmount string `json:"total_amount" binding:"required"`
-	Subject     string `json:"subject" binding:"required"`
-	Body        string `json:"body"`
+	TotalAmount     string `json:"total_amount" binding:"required"`
+	Subject         string `json:"subject" binding:"required"`
+	Body            string `json:"body"`
+	MerchantOrderNo string `json:"merchant_order_no"`
 }
 
 type CreateAppOrderResponse struct {
-	OrderID string `json:"order_id"`
-	PayURL  string `json:"pay_url"`
+	OrderID  string `json:"order_id"`
+	OrderStr string `json:"order_str"`
 }
 
 func CreateAppOrder(c *gin.Context) {
+	logger := logging.FromGin(c)
 	var req CreateAppOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	amount, ok := parseOrderAmount(c, req.TotalAmount)
+	if !ok {
+		return
+	}
+
 	order := &model.Order{
-		OutTradeNo:  generateOutTradeNo(),
-		TotalAmount: req.TotalAmount,
-		Subject:     req.Subject,
-		Body:        req.Body,
+		OutTradeNo:      generateOutTradeNo(),
+		TotalAmount:     amount,
+		Subject:         req.Subject,
+		Body:            req.Body,
+		PayType:         model.PayTypeApp,
+		MerchantOrderNo: req.MerchantOrderNo,
 	}
 
 	if err := model.Store.Create(order); err != nil {
+		logger.Error("create_app_order_store_failed", zap.String("error", err.Error()))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
 		return
 	}
+	markStateWritten(c)
 
-	payReq := &ealipay.AppPayRequest{
+	orderStr, err := alipayClient.AppPay(&ealipay.AppPayRequest{
 		OutTradeNo:  order.OutTradeNo,
-		TotalAmount: order.TotalAmount,
+		TotalAmount: order.TotalAmount.String(),
 		Subject:     order.Subject,
 		Body:        order.Body,
-	}
-
-	payURL, err := alipayClient.WapPay(&ealipay.WapPayRequest{
-		OutTradeNo:  payReq.OutTradeNo,
-		TotalAmount: payReq.TotalAmount,
-		Subject:     payReq.Subject,
-		Body:        payReq.Body,
+		TimeExpire:  ealipay.FormatTime(order.ExpiresAt),
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成支付链接失败"})
+		logger.Error("create_app_order_app_pay_failed", zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成支付参数失败"})
 		return
 	}
 
-	model.Store.UpdateStatus(order.ID, model.OrderStatusPending, "")
-
 	c.JSON(http.StatusOK, CreateAppOrderResponse{
-		OrderID: order.ID,
-		PayURL:  payURL,
+		OrderID:  order.ID,
+		OrderStr: orderStr,
 	})
 }
@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pay/ealipay"
+	"pay/logging"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const billDateLayout = "2006-01-02"
+
+// 支付宝账单按北京时间切日
+var billLocation = time.FixedZone("CST", 8*3600)
+
+// BillReconcilerConfig 控制每日账单对账任务。零值字段使用默认值。
+type BillReconcilerConfig struct {
+	// Hour 是每天核对前一日账单的时刻（北京时间），为空或不在 0-23 之间时默认 10 点；
+	// 支付宝一般在 9 点后生成前一日账单
+	Hour *int
+	// RetryInterval 是下载或核对失败后的重试间隔，默认 30 分钟
+	RetryInterval time.Duration
+	// MaxRetries 是每天最多重试的次数，默认 6
+	MaxRetries int
+}
+
+func (c BillReconcilerConfig) withDefaults() BillReconcilerConfig {
+	if c.Hour == nil || *c.Hour < 0 || *c.Hour > 23 {
+		hour := 10
+		c.Hour = &hour
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = 30 * time.Minute
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 6
+	}
+	return c
+}
+
+const (
+	billReconcilerJobLock = "bill_reconciler"
+	billReconcileLease    = 5 * time.Minute
+)
+
+type billReconcileResult struct {
+	BillDate  string                      `json:"bill_date"`
+	TradeRows int                         `json:"trade_rows"`
+	Diffs     []*model.ReconciliationDiff `json:"diffs"`
+}
+
+// StartBillReconciler 每天在 cfg.Hour 点下载前一日的业务明细账单，与本地订单、退款逐笔核对，
+// 差异写入 reconciliation_diff。多实例部署时由 job_lock 保证同一时刻只有一个实例在核对。ctx 取消后停止。
+func StartBillReconciler(ctx context.Context, cfg BillReconcilerConfig) {
+	cfg = cfg.withDefaults()
+	go func() {
+		for {
+			now := time.Now().In(billLocation)
+			next := time.Date(now.Year(), now.Month(), now.Day(), *cfg.Hour, 0, 0, 0, billLocation)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			if !sleepContext(ctx, time.Until(next)) {
+				return
+			}
+
+			billDate := next.AddDate(0, 0, -1).Format(billDateLayout)
+			for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
+				if attempt > 0 && !sleepContext(ctx, cfg.RetryInterval) {
+					return
+				}
+				var err error
+				ran := runWithJobLock(ctx, billReconcilerJobLock, billReconcileLease, func(ctx context.Context, logger *zap.Logger) {
+					ctx, traceID := logging.WithNewTraceID(ctx)
+					logger = logger.With(zap.String("trace_id", traceID), zap.String("job", "bill_reconcile"))
+					_, err = reconcileBill(ctx, logger, billDate)
+				})
+				if !ran || err == nil {
+					// 锁被其他实例持有时由对方完成当天的核对
+					break
+				}
+			}
+		}
+	}()
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// reconcileBill 下载 billDate 的业务明细账单并核对：
+// 账单中的交易按 out_trade_no 对应订单，退款按 out_request_no 对应退款记录；
+// 当天在本地变为已支付或退款成功、但账单中没有的记录记为 missing_remote。
+// 只下载 trade 类型账单，signcustomer 账务明细（手续费、结算）由财务对账，不在这里核对。
+func reconcileBill(ctx context.Context, logger *zap.Logger, billDate string) (*billReconcileResult, error) {
+	logger = logger.With(zap.String("bill_date", billDate))
+
+	day, err := time.ParseInLocation(billDateLayout, billDate, billLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := alipayClient.BillDownloadURLQueryContext(ctx, &ealipay.BillDownloadURLQueryRequest{
+		BillType: ealipay.BillTypeTrade,
+		BillDate: billDate,
+	})
+	if err != nil {
+		logger.Warn("bill_download_url_query_failed", zap.String("error", err.Error()))
+		return nil, err
+	}
+	data, err := alipayClient.DownloadBill(ctx, resp.BillDownloadURL)
+	if err != nil {
+		logger.Warn("bill_download_failed", zap.String("error", err.Error()))
+		return nil, err
+	}
+	bill, err := ealipay.ParseBillZip(data)
+	if err != nil {
+		logger.Error("bill_parse_failed", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	diffs := diffBill(bill.TradeRows, day, day.AddDate(0, 0, 1))
+	if err := model.ReconciliationDiffs.ReplaceForDate(billDate, diffs); err != nil {
+		logger.Error("bill_reconcile_save_failed", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	counts := make(map[model.ReconciliationDiffType]int)
+	for _, d := range diffs {
+		counts[d.DiffType]++
+	}
+	fields := []zap.Field{zap.Int("trade_rows", len(bill.TradeRows)), zap.Int("diffs", len(diffs))}
+	for diffType, n := range counts {
+		fields = append(fields, zap.Int(string(diffType), n))
+	}
+	if len(diffs) > 0 {
+		logger.Warn("bill_reconcile_diff_found", fields...)
+	} else {
+		logger.Info("bill_reconcile_ok", fields...)
+	}
+	return &billReconcileResult{BillDate: billDate, TradeRows: len(bill.TradeRows), Diffs: diffs}, nil
+}
+
+func diffBill(rows []ealipay.TradeBillRow, start, end time.Time) []*model.ReconciliationDiff {
+	diffs := make([]*model.ReconciliationDiff, 0)
+	seenOrders := make(map[string]bool)
+	seenRefunds := make(map[string]bool)
+
+	for _, row := range rows {
+		switch row.BizType {
+		case ealipay.BillBizTypeTrade:
+			diff := &model.ReconciliationDiff{
+				OutTradeNo:    row.OutTradeNo,
+				TradeNo:       row.TradeNo,
+				RemoteAmount:  model.Money(row.TotalAmount),
+				RemoteBizType: row.BizType,
+			}
+			order, exists := model.Store.GetByOutTradeNo(row.OutTradeNo)
+			if !exists {
+				diff.DiffType = model.DiffMissingLocal
+				diffs = append(diffs, diff)
+				continue
+			}
+			seenOrders[order.ID] = true
+			diff.OrderID = order.ID
+			diff.LocalAmount = order.TotalAmount
+			diff.LocalStatus = string(order.Status)
+			if order.TotalAmount != diff.RemoteAmount {
+				diff.DiffType = model.DiffAmountMismatch
+				diffs = append(diffs, diff)
+			}
+			if order.TradeNo != "" && order.TradeNo != row.TradeNo {
+				diffs = append(diffs, tradeNoDiff(diff, order.TradeNo))
+			}
+			if !orderSettled(order.Status) {
+				statusDiff := *diff
+				statusDiff.DiffType = model.DiffStatusMismatch
+				diffs = append(diffs, &statusDiff)
+			}
+		case ealipay.BillBizTypeRefund:
+			// 账单中退款行的金额为负数
+			diff := &model.ReconciliationDiff{
+				OutTradeNo:    row.OutTradeNo,
+				TradeNo:       row.TradeNo,
+				OutRequestNo:  row.OutRequestNo,
+				RemoteAmount:  -model.Money(row.TotalAmount),
+				RemoteBizType: row.BizType,
+			}
+			refund, exists := model.Refunds.GetByOutRequestNo(row.OutRequestNo)
+			if row.OutRequestNo == "" || !exists {
+				diff.DiffType = model.DiffMissingLocal
+				diffs = append(diffs, diff)
+				continue
+			}
+			seenRefunds[refund.ID] = true
+			diff.OrderID = refund.OrderID
+			diff.RefundID = refund.ID
+			diff.LocalAmount = refund.RefundAmount
+			diff.LocalStatus = string(refund.Status)
+			if refund.RefundAmount != diff.RemoteAmount {
+				diff.DiffType = model.DiffAmountMismatch
+				diffs = append(diffs, diff)
+			}
+			if refund.TradeNo != "" && refund.TradeNo != row.TradeNo {
+				diffs = append(diffs, tradeNoDiff(diff, refund.TradeNo))
+			}
+			if refund.Status != model.RefundStatusSuccess {
+				statusDiff := *diff
+				statusDiff.DiffType = model.DiffStatusMismatch
+				diffs = append(diffs, &statusDiff)
+			}
+		}
+	}
+
+	for _, order := range model.Store.ListPaidBetween(start, end) {
+		if seenOrders[order.ID] {
+			continue
+		}
+		diffs = append(diffs, &model.ReconciliationDiff{
+			DiffType:    model.DiffMissingRemote,
+			OrderID:     order.ID,
+			OutTradeNo:  order.OutTradeNo,
+			TradeNo:     order.TradeNo,
+			LocalAmount: order.TotalAmount,
+			LocalStatus: string(order.Status),
+		})
+	}
+	for _, refund := range model.Refunds.ListSucceededBetween(start, end) {
+		if seenRefunds[refund.ID] {
+			continue
+		}
+		diffs = append(diffs, &model.ReconciliationDiff{
+			DiffType:     model.DiffMissingRemote,
+			OrderID:      refund.OrderID,
+			RefundID:     refund.ID,
+			OutTradeNo:   refund.OutTradeNo,
+			TradeNo:      refund.TradeNo,
+			OutRequestNo: refund.OutRequestNo,
+			LocalAmount:  refund.RefundAmount,
+			LocalStatus:  string(refund.Status),
+		})
+	}
+	return diffs
+}
+
+// tradeNoDiff 复制账单行的差异记录，TradeNo 保留账单中的交易号，本地交易号写在 Detail 中。
+func tradeNoDiff(diff *model.ReconciliationDiff, localTradeNo string) *model.ReconciliationDiff {
+	d := *diff
+	d.DiffType = model.DiffTradeNoMismatch
+	d.Detail = "本地交易号 " + localTradeNo
+	return &d
+}
+
+// orderSettled 判断订单是否已经收款，退款不影响原交易在账单中的记录。
+func orderSettled(status model.OrderStatus) bool {
+	switch status {
+	case model.OrderStatusPaid, model.OrderStatusPartiallyRefunded, model.OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func parseBillDate(c *gin.Context) (string, bool) {
+	billDate := c.Param("date")
+	if _, err := time.ParseInLocation(billDateLayout, billDate, billLocation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("账单日期格式应为 %s", billDateLayout)})
+		return "", false
+	}
+	return billDate, true
+}
+
+// ReconcileBill 手动核对指定日期的账单，结果覆盖该日期之前的差异记录。
+func ReconcileBill(c *gin.Context) {
+	billDate, ok := parseBillDate(c)
+	if !ok {
+		return
+	}
+
+	// 与定时核对共用 job_lock，避免两边同时覆盖同一天的差异记录
+	var result *billReconcileResult
+	var err error
+	ran := runWithJobLock(c.Request.Context(), billReconcilerJobLock, billReconcileLease, func(ctx context.Context, _ *zap.Logger) {
+		result, err = reconcileBill(ctx, logging.FromGin(c), billDate)
+	})
+	if !ran {
+		c.JSON(http.StatusConflict, gin.H{"error": "账单核对正在进行，请稍后重试"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func ListReconciliationDiffs(c *gin.Context) {
+	billDate, ok := parseBillDate(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, model.ReconciliationDiffs.ListByDate(billDate))
+}
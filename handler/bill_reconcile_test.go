@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pay/ealipay"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiffBillUsesGmtPaymentAndTradeNo(t *testing.T) {
+	order := &model.Order{OutTradeNo: generateOutTradeNo(), TotalAmount: 1000, Subject: "test", PayType: model.PayTypePage}
+	if err := model.Store.Create(order); err != nil {
+		t.Fatal(err)
+	}
+	// 通知在零点之后才到达，付款时间仍是前一天
+	day := time.Date(2026, 10, 17, 0, 0, 0, 0, billLocation)
+	paidAt := day.Add(23*time.Hour + 59*time.Minute)
+	change := model.StatusChange{Source: model.TransitionSourceNotify, PaidAt: paidAt}
+	if err := model.Store.TransitionStatus(order, model.OrderStatusPaid, "2026101722001", change); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := model.Store.GetByID(order.ID)
+	if got.GmtPayment == nil || !got.GmtPayment.Equal(paidAt) {
+		t.Fatalf("gmt_payment = %v, want %v", got.GmtPayment, paidAt)
+	}
+
+	diffsFor := func(rows []ealipay.TradeBillRow, start time.Time) []*model.ReconciliationDiff {
+		var diffs []*model.ReconciliationDiff
+		for _, d := range diffBill(rows, start, start.AddDate(0, 0, 1)) {
+			if d.OrderID == order.ID {
+				diffs = append(diffs, d)
+			}
+		}
+		return diffs
+	}
+
+	if diffs := diffsFor(nil, day.AddDate(0, 0, 1)); len(diffs) != 0 {
+		t.Fatalf("next day diffs = %+v, want none", diffs)
+	}
+	if diffs := diffsFor(nil, day); len(diffs) != 1 || diffs[0].DiffType != model.DiffMissingRemote {
+		t.Fatalf("paid day diffs = %+v, want missing_remote", diffs)
+	}
+
+	rows := []ealipay.TradeBillRow{{
+		TradeNo:     "2026101722999",
+		OutTradeNo:  order.OutTradeNo,
+		BizType:     ealipay.BillBizTypeTrade,
+		TotalAmount: 1000,
+	}}
+	diffs := diffsFor(rows, day)
+	if len(diffs) != 1 || diffs[0].DiffType != model.DiffTradeNoMismatch || diffs[0].TradeNo != "2026101722999" {
+		t.Fatalf("diffs = %+v, want trade_no_mismatch", diffs)
+	}
+}
+
+func TestBillReconcilerConfigHour(t *testing.T) {
+	hour := func(h int) *int { return &h }
+	tests := []struct {
+		hour *int
+		want int
+	}{
+		{nil, 10},
+		{hour(0), 0},
+		{hour(23), 23},
+		{hour(-1), 10},
+		{hour(24), 10},
+	}
+	for _, tt := range tests {
+		if got := *(BillReconcilerConfig{Hour: tt.hour}).withDefaults().Hour; got != tt.want {
+			t.Errorf("withDefaults hour %v = %d, want %d", tt.hour, got, tt.want)
+		}
+	}
+}
+
+func TestReconcileBillRespectsJobLock(t *testing.T) {
+	newTestApp(t)
+	r := gin.New()
+	r.POST("/api/reconciliations/:date", ReconcileBill)
+	app := httptest.NewServer(r)
+	t.Cleanup(app.Close)
+	url := app.URL + "/api/reconciliations/" + time.Now().In(billLocation).AddDate(0, 0, -1).Format(billDateLayout)
+
+	// 其他实例正在跑定时核对
+	lock, err := model.JobLocks.Acquire(billReconcilerJobLock, model.NewLockOwner(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := postJSON(t, url, nil, nil); code != http.StatusConflict {
+		t.Fatalf("reconcile with lock held status = %d, want 409", code)
+	}
+
+	if err := model.JobLocks.Release(lock); err != nil {
+		t.Fatal(err)
+	}
+	if code := postJSON(t, url, nil, nil); code != http.StatusOK {
+		t.Fatalf("reconcile after release status = %d, want 200", code)
+	}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"pay/logging"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 128
+	// idempotencyStaleAfter 之后仍未完成的占位视为处理进程已经崩溃，允许新请求接管。
+	idempotencyStaleAfter = time.Minute
+	// idempotencyStateWrittenKey 由 markStateWritten 写入 gin.Context
+	idempotencyStateWrittenKey = "idempotency_state_written"
+)
+
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent 让创建订单的接口支持 Idempotency-Key 请求头，没有请求头时使用请求体里的 merchant_order_no。
+// 相同 key 且请求体相同的重复请求回放第一次的应答；key 相同但请求体不同返回 409。
+func Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := logging.FromGin(c)
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "读取请求失败"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := idempotencyKey(c, body)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key 过长"})
+			return
+		}
+
+		scope := c.Request.Method + " " + c.FullPath()
+		hash := requestHash(body)
+		existing, reserved, err := model.Idempotency.Reserve(&model.IdempotencyRecord{
+			Scope:       scope,
+			Key:         key,
+			RequestHash: hash,
+		}, time.Now().Add(-idempotencyStaleAfter))
+		if err != nil {
+			logger.Error("idempotency_reserve_failed", zap.String("key", key), zap.String("error", err.Error()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "处理幂等请求失败"})
+			return
+		}
+		if !reserved {
+			switch {
+			case existing.RequestHash != hash:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Idempotency-Key 已用于不同的请求"})
+			case !existing.Completed:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "相同 Idempotency-Key 的请求正在处理，请稍后重试"})
+			default:
+				logger.Info("idempotency_replay", zap.String("key", key), zap.Int("status", existing.StatusCode))
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.StatusCode, "application/json; charset=utf-8", []byte(existing.ResponseBody))
+				c.Abort()
+			}
+			return
+		}
+
+		w := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		// 5xx 且还没有写入任何状态时释放占位，让客户端用同一个 key 重试；
+		// 已经创建了订单的 5xx 照常记录，重试回放这次的应答，不会再创建一笔订单
+		if w.Status() >= http.StatusInternalServerError && !c.GetBool(idempotencyStateWrittenKey) {
+			err = model.Idempotency.Release(scope, key)
+		} else {
+			err = model.Idempotency.Complete(scope, key, w.Status(), w.body.String())
+		}
+		if err != nil {
+			logger.Error("idempotency_record_failed", zap.String("key", key), zap.String("error", err.Error()))
+		}
+	}
+}
+
+// markStateWritten 告诉 Idempotent 本次请求已经写入了订单等状态，之后即使应答 5xx 也不释放 key。
+func markStateWritten(c *gin.Context) {
+	c.Set(idempotencyStateWrittenKey, true)
+}
+
+func idempotencyKey(c *gin.Context, body []byte) string {
+	if key := c.GetHeader(idempotencyKeyHeader); key != "" {
+		return key
+	}
+	var payload struct {
+		MerchantOrderNo string `json:"merchant_order_no"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	return payload.MerchantOrderNo
+}
+
+// requestHash 对 JSON 请求体做规范化后取摘要，字段顺序或空白不同不算不同的请求。
+func requestHash(body []byte) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		if normalized, err := json.Marshal(v); err == nil {
+			body = normalized
+		}
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
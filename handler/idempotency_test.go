@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pay/ealipay"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotentKeepsKeyWhenOrderCreated(t *testing.T) {
+	srv, _ := newTestApp(t)
+	cfg := srv.Config()
+	cfg.Retry = ealipay.RetryPolicy{MaxAttempts: 1}
+	if err := InitAlipayClient(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/api/orders", Idempotent(), CreateOrder)
+	app := httptest.NewServer(r)
+	t.Cleanup(app.Close)
+
+	// 订单已经落库后预下单失败，应答 502
+	srv.FailNext("alipay.trade.precreate", ealipay.Error{Code: ealipay.CodeUnknownError, Msg: "Service Currently Unavailable", SubCode: ealipay.SubCodeSystemError})
+	before := len(model.Store.List())
+	body := gin.H{"total_amount": "10.00", "subject": "test", "pay_type": string(model.PayTypePrecreate), "merchant_order_no": "idem-created-5xx"}
+	if code := postJSON(t, app.URL+"/api/orders", body, nil); code != http.StatusBadGateway {
+		t.Fatalf("first create status = %d, want 502", code)
+	}
+
+	// 同一个 key 重试回放第一次的应答，不会再创建一笔订单
+	if code := postJSON(t, app.URL+"/api/orders", body, nil); code != http.StatusBadGateway {
+		t.Fatalf("retry status = %d, want replayed 502", code)
+	}
+	if got := len(model.Store.List()) - before; got != 1 {
+		t.Fatalf("orders created = %d, want 1", got)
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"pay/logging"
+	"pay/model"
+
+	"go.uber.org/zap"
+)
+
+// jobLockOwner 标识当前进程，同一进程内的所有后台任务共用。
+var jobLockOwner = model.NewLockOwner()
+
+// runWithJobLock 获取名为 name 的租约后执行 fn，执行期间每 ttl/3 续约一次。
+// 锁被其他实例持有时直接返回 false；续约失败会取消传给 fn 的 ctx，fn 应尽快退出。
+func runWithJobLock(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context, logger *zap.Logger)) bool {
+	lock, err := model.JobLocks.Acquire(name, jobLockOwner, ttl)
+	if errors.Is(err, model.ErrLockHeld) {
+		return false
+	}
+	if err != nil {
+		logging.L().Error("job_lock_acquire_failed", zap.String("job_lock", name), zap.String("error", err.Error()))
+		return false
+	}
+
+	logger := logging.WithJobLock(logging.L(), lock.Name, lock.Owner, lock.Token)
+	logger.Debug("job_lock_acquired")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := model.JobLocks.Renew(lock, ttl); err != nil {
+					logger.Warn("job_lock_lost", zap.String("error", err.Error()))
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	fn(ctx, logger)
+	cancel()
+	<-renewed
+
+	if err := model.JobLocks.Release(lock); err != nil && !errors.Is(err, model.ErrLockLost) {
+		logger.Warn("job_lock_release_failed", zap.String("error", err.Error()))
+	}
+	return true
+}
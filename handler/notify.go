@@ -2,10 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
+	"pay/ealipay"
 	"pay/logging"
 	"pay/model"
 
@@ -13,152 +15,172 @@ import (
 	"go.uber.org/zap"
 )
 
-type AlipayNotifyRequest struct {
-	AppId       string `json:"app_id"`
-	TradeNo     string `json:"trade_no"`
-	OutTradeNo  string `json:"out_trade_no"`
-	TotalAmount string `json:"total_amount"`
-	TradeStatus string `json:"trade_status"`
-	NotifyTime  string `json:"notify_time"`
-	NotifyType  string `json:"notify_type"`
-	NotifyId    string `json:"notify_id"`
-	Subject     string `json:"subject"`
-	Body        string `json:"body"`
-	BuyerId     string `json:"buyer_id"`
-}
-
 func AlipayNotify(c *gin.Context) {
 	logger := logging.FromGin(c)
-	if err := c.Request.ParseForm(); err != nil {
-		logger.Warn("alipay_notify_parse_form_failed", zap.String("error", err.Error()))
+
+	notification, err := alipayClient.ParseNotification(c.Request)
+	if err != nil {
+		log := newAlipayCallbackLog(c, ealipay.NotificationParams(c.Request.Form))
+		log.VerifyError = err.Error()
+		writeCallbackLogAsync(log)
+		logger.Warn("alipay_notify_verify_failed", zap.String("error", err.Error()))
 		c.String(http.StatusOK, "fail")
 		return
 	}
 
-	params := make(map[string]string, len(c.Request.Form))
-	for k, vs := range c.Request.Form {
-		if len(vs) == 0 {
-			continue
+	log := newAlipayCallbackLog(c, notification.Params)
+	log.VerifyOK = true
+
+	if notification.NotifyID != "" {
+		duplicate, err := model.ProcessedNotifications.RecordDuplicate(notification.NotifyID)
+		if err != nil {
+			// 去重表不可用时继续处理，状态流转本身是幂等的
+			logger.Error("alipay_notify_dedup_failed", zap.String("notify_id", notification.NotifyID), zap.String("error", err.Error()))
+		}
+		if duplicate {
+			log.Duplicate = true
+			writeCallbackLogAsync(log)
+			logger.Info("alipay_notify_duplicate", zap.String("notify_id", notification.NotifyID), zap.String("out_trade_no", notification.OutTradeNo))
+			c.String(http.StatusOK, "success")
+			return
 		}
-		params[k] = strings.Join(vs, ",")
 	}
 
-	sign := params["sign"]
-
-	headersJSON := ""
-	if b, err := json.Marshal(c.Request.Header); err == nil {
-		headersJSON = string(b)
-	}
-	paramsJSON := ""
-	if b, err := json.Marshal(params); err == nil {
-		paramsJSON = string(b)
+	order, exists := model.Store.GetByOutTradeNo(notification.OutTradeNo)
+	if !exists {
+		log.VerifyError = model.CallbackVerifyOrderNotFound
+		writeCallbackLogAsync(log)
+		logger.Warn("alipay_notify_order_not_found", zap.String("out_trade_no", notification.OutTradeNo))
+		c.String(http.StatusOK, "fail")
+		return
 	}
 
-	if err := alipayClient.VerifySign(params, sign); err != nil {
-		writeCallbackLogAsync(model.CallbackLog{
-			Provider:    "alipay",
-			Path:        c.FullPath(),
-			Method:      c.Request.Method,
-			RemoteIP:    c.ClientIP(),
-			TraceID:     logging.TraceIDFromGin(c),
-			AppID:       params["app_id"],
-			OutTradeNo:  params["out_trade_no"],
-			TradeNo:     params["trade_no"],
-			TradeStatus: params["trade_status"],
-			NotifyID:    params["notify_id"],
-			Sign:        sign,
-			VerifyOK:    false,
-			VerifyError: err.Error(),
-			ParamsJSON:  paramsJSON,
-			HeadersJSON: headersJSON,
-			ReceivedAt:  time.Now(),
-		})
-		logger.Warn("alipay_notify_verify_failed", zap.String("error", err.Error()))
+	if err := checkTradeMatchesOrder(order, notification.AppID, notification.SellerID, notification.TotalAmount); err != nil {
+		log.VerifyError = model.CallbackVerifyTradeMismatch + ": " + err.Error()
+		writeCallbackLogAsync(log)
+		alertTradeMismatch(logger, "notify", order, notification.TradeNo, err)
 		c.String(http.StatusOK, "fail")
 		return
 	}
 
-	outTradeNo := params["out_trade_no"]
-	tradeStatus := params["trade_status"]
-	tradeNo := params["trade_no"]
-
-	order, exists := model.Store.GetByOutTradeNo(outTradeNo)
-	if !exists {
-		writeCallbackLogAsync(model.CallbackLog{
-			Provider:    "alipay",
-			Path:        c.FullPath(),
-			Method:      c.Request.Method,
-			RemoteIP:    c.ClientIP(),
-			TraceID:     logging.TraceIDFromGin(c),
-			AppID:       params["app_id"],
-			OutTradeNo:  outTradeNo,
-			TradeNo:     tradeNo,
-			TradeStatus: tradeStatus,
-			NotifyID:    params["notify_id"],
-			Sign:        sign,
-			VerifyOK:    true,
-			VerifyError: "order not found",
-			ParamsJSON:  paramsJSON,
-			HeadersJSON: headersJSON,
-			ReceivedAt:  time.Now(),
-		})
-		logger.Warn("alipay_notify_order_not_found", zap.String("out_trade_no", outTradeNo))
+	nextStatus := orderStatusFromTrade(order.Status, notification.TradeStatus)
+	change := statusChange(c, model.TransitionSourceNotify)
+	change.PaidAt = notification.GmtPayment
+	err = model.Store.TransitionStatus(order, nextStatus, notification.TradeNo, change)
+	if errors.Is(err, model.ErrConcurrentUpdate) {
+		// 同步或其他通知刚刚修改了订单，返回 fail 让支付宝稍后重发，届时按最新状态处理
+		writeCallbackLogAsync(log)
+		logger.Warn("alipay_notify_conflict", zap.String("order_id", order.ID), zap.String("trade_status", notification.TradeStatus))
 		c.String(http.StatusOK, "fail")
 		return
 	}
-
-	nextStatus := order.Status
-	switch tradeStatus {
-	case "WAIT_BUYER_PAY":
-		nextStatus = model.OrderStatusPending
-	case "TRADE_SUCCESS", "TRADE_FINISHED":
-		nextStatus = model.OrderStatusPaid
-	case "TRADE_CLOSED":
-		nextStatus = model.OrderStatusClosed
+	if errors.Is(err, model.ErrInvalidTransition) {
+		// 通知乱序或重复投递，订单已经走到更后面的状态，确认收到即可；
+		// 已关闭的订单收到付款不会重新打开，告警后由人工退款或补单
+		if order.Status == model.OrderStatusClosed && nextStatus == model.OrderStatusPaid {
+			alertPaidAfterClose(logger, "notify", order, notification.TradeNo)
+		}
+		markNotificationProcessed(logger, order, notification)
+		writeCallbackLogAsync(log)
+		logger.Warn("alipay_notify_stale_status", zap.String("order_id", order.ID), zap.String("trade_status", notification.TradeStatus), zap.String("error", err.Error()))
+		c.String(http.StatusOK, "success")
+		return
 	}
-
-	if err := model.Store.UpdateStatus(order.ID, nextStatus, tradeNo); err != nil {
-		writeCallbackLogAsync(model.CallbackLog{
-			Provider:    "alipay",
-			Path:        c.FullPath(),
-			Method:      c.Request.Method,
-			RemoteIP:    c.ClientIP(),
-			TraceID:     logging.TraceIDFromGin(c),
-			AppID:       params["app_id"],
-			OutTradeNo:  outTradeNo,
-			TradeNo:     tradeNo,
-			TradeStatus: tradeStatus,
-			NotifyID:    params["notify_id"],
-			Sign:        sign,
-			VerifyOK:    true,
-			ParamsJSON:  paramsJSON,
-			HeadersJSON: headersJSON,
-			ReceivedAt:  time.Now(),
-		})
+	if err != nil {
+		writeCallbackLogAsync(log)
 		logger.Error("alipay_notify_update_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
 		c.String(http.StatusOK, "fail")
 		return
 	}
 
-	writeCallbackLogAsync(model.CallbackLog{
+	markNotificationProcessed(logger, order, notification)
+	writeCallbackLogAsync(log)
+	logger.Info("alipay_notify_ok", zap.String("order_id", order.ID), zap.String("out_trade_no", notification.OutTradeNo), zap.String("trade_no", notification.TradeNo), zap.String("trade_status", notification.TradeStatus), zap.String("status", string(nextStatus)))
+	c.String(http.StatusOK, "success")
+}
+
+// markNotificationProcessed 在通知的副作用完成后记录 notify_id，之后的重复投递直接确认。
+// 并发投递的同一通知可能都走到这里，只有第一条会写入成功。
+func markNotificationProcessed(logger *zap.Logger, order *model.Order, notification *ealipay.Notification) {
+	if notification.NotifyID == "" {
+		return
+	}
+	_, err := model.ProcessedNotifications.MarkProcessed(&model.ProcessedNotification{
+		NotifyID:    notification.NotifyID,
+		OrderID:     order.ID,
+		OutTradeNo:  notification.OutTradeNo,
+		TradeNo:     notification.TradeNo,
+		TradeStatus: notification.TradeStatus,
+	})
+	if err != nil {
+		logger.Error("alipay_notify_mark_processed_failed", zap.String("notify_id", notification.NotifyID), zap.String("error", err.Error()))
+	}
+}
+
+// checkTradeMatchesOrder 按支付宝接入要求校验通知或查询结果确实属于这笔订单：
+// 金额与下单金额一致，app_id 与 seller_id 属于当前商户。空的 app_id / seller_id 不校验。
+func checkTradeMatchesOrder(order *model.Order, appID, sellerID string, totalAmount ealipay.Amount) error {
+	expected := ealipay.Amount(order.TotalAmount)
+	if totalAmount != expected {
+		return fmt.Errorf("total_amount %s != %s", totalAmount, expected)
+	}
+	if appID != "" && appID != alipayClient.AppId {
+		return fmt.Errorf("app_id %s != %s", appID, alipayClient.AppId)
+	}
+	if sellerID != "" && alipayClient.SellerId != "" && sellerID != alipayClient.SellerId {
+		return fmt.Errorf("seller_id %s != %s", sellerID, alipayClient.SellerId)
+	}
+	return nil
+}
+
+func alertTradeMismatch(logger *zap.Logger, source string, order *model.Order, tradeNo string, err error) {
+	logger.Error("alipay_trade_mismatch_alert",
+		zap.String("source", source),
+		zap.String("order_id", order.ID),
+		zap.String("out_trade_no", order.OutTradeNo),
+		zap.String("trade_no", tradeNo),
+		zap.String("error", err.Error()),
+	)
+}
+
+// alertPaidAfterClose 记录本地已关闭、支付宝却已收款的订单。closed 不会再流转为 paid，
+// 这笔钱只能人工处理，因此按告警级别记录。
+func alertPaidAfterClose(logger *zap.Logger, source string, order *model.Order, tradeNo string) {
+	logger.Error("alipay_paid_after_close_alert",
+		zap.String("source", source),
+		zap.String("order_id", order.ID),
+		zap.String("out_trade_no", order.OutTradeNo),
+		zap.String("trade_no", tradeNo),
+		zap.Stringer("total_amount", order.TotalAmount),
+	)
+}
+
+func newAlipayCallbackLog(c *gin.Context, params map[string]string) model.CallbackLog {
+	headersJSON := ""
+	if b, err := json.Marshal(c.Request.Header); err == nil {
+		headersJSON = string(b)
+	}
+	paramsJSON := ""
+	if b, err := json.Marshal(params); err == nil {
+		paramsJSON = string(b)
+	}
+
+	return model.CallbackLog{
 		Provider:    "alipay",
 		Path:        c.FullPath(),
 		Method:      c.Request.Method,
 		RemoteIP:    c.ClientIP(),
 		TraceID:     logging.TraceIDFromGin(c),
 		AppID:       params["app_id"],
-		OutTradeNo:  outTradeNo,
-		TradeNo:     tradeNo,
-		TradeStatus: tradeStatus,
+		OutTradeNo:  params["out_trade_no"],
+		TradeNo:     params["trade_no"],
+		TradeStatus: params["trade_status"],
 		NotifyID:    params["notify_id"],
-		Sign:        sign,
-		VerifyOK:    true,
+		Sign:        params["sign"],
 		ParamsJSON:  paramsJSON,
 		HeadersJSON: headersJSON,
 		ReceivedAt:  time.Now(),
-	})
-	logger.Info("alipay_notify_ok", zap.String("order_id", order.ID), zap.String("out_trade_no", outTradeNo), zap.String("trade_no", tradeNo), zap.String("trade_status", tradeStatus), zap.String("status", string(nextStatus)))
-	c.String(http.StatusOK, "success")
+	}
 }
 
 func writeCallbackLogAsync(log model.CallbackLog) {
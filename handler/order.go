@@ -3,6 +3,7 @@ package handler
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
@@ -17,9 +18,11 @@ import (
 )
 
 type CreateOrderRequest struct {
-	TotalAmount string `json:"total_amount" binding:"required"`
-	Subject     string `json:"subject" binding:"required"`
-	Body        string `json:"body"`
+	TotalAmount     string `json:"total_amount" binding:"required"`
+	Subject         string `json:"subject" binding:"required"`
+	Body            string `json:"body"`
+	PayType         string `json:"pay_type"`
+	MerchantOrderNo string `json:"merchant_order_no"`
 }
 
 type CreateOrderResponse struct {
@@ -53,32 +56,70 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	order := &model.Order{
-		OutTradeNo:  generateOutTradeNo(),
-		TotalAmount: req.TotalAmount,
-		Subject:     req.Subject,
-		Body:        req.Body,
+	payType := model.PayType(req.PayType)
+	switch payType {
+	case "":
+		payType = model.PayTypePage
+	case model.PayTypePage, model.PayTypePrecreate:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的支付方式"})
+		return
 	}
 
-	if err := model.Store.Create(order); err != nil {
-		logger.Error("create_order_store_failed", zap.String("error", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
+	amount, ok := parseOrderAmount(c, req.TotalAmount)
+	if !ok {
 		return
 	}
 
-	payReq := &ealipay.PagePayRequest{
-		OutTradeNo:  order.OutTradeNo,
-		TotalAmount: order.TotalAmount,
-		Subject:     order.Subject,
-		Body:        order.Body,
+	order := &model.Order{
+		OutTradeNo:      generateOutTradeNo(),
+		TotalAmount:     amount,
+		Subject:         req.Subject,
+		Body:            req.Body,
+		PayType:         payType,
+		MerchantOrderNo: req.MerchantOrderNo,
 	}
 
-	payUrl, err := alipayClient.PagePay(payReq)
-	if err != nil {
-		logger.Error("create_order_page_pay_failed", zap.String("error", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成支付链接失败"})
+	if err := model.Store.Create(order); err != nil {
+		logger.Error("create_order_store_failed", zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
 		return
 	}
+	markStateWritten(c)
+
+	var payUrl string
+	switch payType {
+	case model.PayTypePrecreate:
+		resp, err := alipayClient.TradePrecreateContext(c.Request.Context(), &ealipay.TradePrecreateRequest{
+			OutTradeNo:  order.OutTradeNo,
+			TotalAmount: order.TotalAmount.String(),
+			Subject:     order.Subject,
+			Body:        order.Body,
+			TimeExpire:  ealipay.FormatTime(order.ExpiresAt),
+		})
+		if err != nil {
+			logger.Error("create_order_precreate_failed", zap.String("error", err.Error()))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "支付宝预下单失败", "detail": err.Error()})
+			return
+		}
+		payUrl = resp.QrCode
+	default:
+		payReq := &ealipay.PagePayRequest{
+			OutTradeNo:  order.OutTradeNo,
+			TotalAmount: order.TotalAmount.String(),
+			Subject:     order.Subject,
+			Body:        order.Body,
+			TimeExpire:  ealipay.FormatTime(order.ExpiresAt),
+		}
+
+		url, err := alipayClient.PagePay(payReq)
+		if err != nil {
+			logger.Error("create_order_page_pay_failed", zap.String("error", err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成支付链接失败"})
+			return
+		}
+		payUrl = url
+	}
 
 	qrCodeData, err := qrcode.Encode(payUrl, qrcode.Medium, 256)
 	if err != nil {
@@ -90,7 +131,6 @@ func CreateOrder(c *gin.Context) {
 	qrCodeBase64 := fmt.Sprintf("data:image/png;base64,%s", base64.StdEncoding.EncodeToString(qrCodeData))
 
 	order.QrCode = qrCodeBase64
-	model.Store.UpdateStatus(order.ID, model.OrderStatusPending, "")
 
 	c.JSON(http.StatusOK, CreateOrderResponse{
 		OrderID:   order.ID,
@@ -99,6 +139,16 @@ func CreateOrder(c *gin.Context) {
 	})
 }
 
+// parseOrderAmount 严格解析下单金额，失败时直接应答 400。
+func parseOrderAmount(c *gin.Context, s string) (model.Money, bool) {
+	amount, err := model.ParseMoney(s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单金额，应为 0.01 到 100000000.00 元且最多两位小数", "detail": err.Error()})
+		return 0, false
+	}
+	return amount, true
+}
+
 func GetOrder(c *gin.Context) {
 	orderID := c.Param("id")
 
@@ -116,6 +166,28 @@ func ListOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, orders)
 }
 
+func ListOrderStatusHistory(c *gin.Context) {
+	orderID := c.Param("id")
+
+	if _, exists := model.Store.GetByID(orderID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Store.ListStatusHistory(orderID))
+}
+
+func ListOrderEvents(c *gin.Context) {
+	orderID := c.Param("id")
+
+	if _, exists := model.Store.GetByID(orderID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.OrderEvents.ListByOrderID(orderID))
+}
+
 func UpdateOrderStatus(c *gin.Context) {
 	orderID := c.Param("id")
 
@@ -141,12 +213,25 @@ func UpdateOrderStatus(c *gin.Context) {
 		status = model.OrderStatusFailed
 	case "closed":
 		status = model.OrderStatusClosed
+	case "partially_refunded":
+		status = model.OrderStatusPartiallyRefunded
+	case "refunded":
+		status = model.OrderStatusRefunded
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单状态"})
 		return
 	}
 
-	if err := model.Store.UpdateStatus(order.ID, status, req.TradeNo); err != nil {
+	err := model.Store.TransitionStatus(order, status, req.TradeNo, statusChange(c, model.TransitionSourceAdmin))
+	if errors.Is(err, model.ErrConcurrentUpdate) {
+		c.JSON(http.StatusConflict, gin.H{"error": "订单状态已被其他请求修改，请刷新后重试"})
+		return
+	}
+	if errors.Is(err, model.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"error": "订单状态不允许这样变更", "detail": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单状态失败"})
 		return
 	}
@@ -169,36 +254,140 @@ func SyncOrderStatus(c *gin.Context) {
 		return
 	}
 
-	resp, err := alipayClient.TradeQuery(&ealipay.TradeQueryRequest{OutTradeNo: order.OutTradeNo})
-	if err != nil {
-		logger.Error("sync_order_trade_query_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
-		c.JSON(http.StatusBadGateway, gin.H{"error": "查询支付宝订单失败", "detail": err.Error()})
+	result, err := syncOrder(c.Request.Context(), logger, order, statusChange(c, model.TransitionSourceSync))
+	switch {
+	case errors.Is(err, errTradeMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": "支付宝交易与订单不一致", "detail": err.Error()})
+		return
+	case errors.Is(err, model.ErrConcurrentUpdate):
+		c.JSON(http.StatusConflict, gin.H{"error": "订单状态已被其他请求修改，请重试"})
+		return
+	case errors.Is(err, errOrderUpdateFailed):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单状态失败"})
+		return
+	case err != nil:
+		status := http.StatusBadGateway
+		if ealipay.IsRetryable(err) || errors.Is(err, ealipay.ErrCircuitOpen) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": "查询支付宝订单失败", "detail": err.Error()})
+		return
+	}
+
+	body := gin.H{
+		"order":               result.Order,
+		"alipay_trade_status": result.TradeStatus,
+	}
+	if result.Detail != "" {
+		body["detail"] = result.Detail
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+func CancelOrder(c *gin.Context) {
+	logger := logging.FromGin(c)
+	orderID := c.Param("id")
+
+	order, exists := model.Store.GetByID(orderID)
+	if !exists {
+		logger.Warn("cancel_order_not_found", zap.String("order_id", orderID))
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	if order.Status == model.OrderStatusClosed {
+		c.JSON(http.StatusOK, gin.H{"order": order})
+		return
+	}
+	if order.Status != model.OrderStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "订单当前状态不能取消", "status": order.Status})
 		return
 	}
 
-	nextStatus := order.Status
-	switch resp.TradeStatus {
-	case "WAIT_BUYER_PAY":
-		nextStatus = model.OrderStatusPending
-	case "TRADE_SUCCESS", "TRADE_FINISHED":
-		nextStatus = model.OrderStatusPaid
-	case "TRADE_CLOSED":
-		nextStatus = model.OrderStatusClosed
-	case "TRADE_FAIL":
-		nextStatus = model.OrderStatusFailed
+	action := "close"
+	tradeNo := ""
+	closeResp, err := alipayClient.TradeCloseContext(c.Request.Context(), &ealipay.TradeCloseRequest{OutTradeNo: order.OutTradeNo})
+	switch {
+	case err == nil:
+		tradeNo = closeResp.TradeNo
+	case ealipay.IsTradeNotExist(err):
+		// 买家尚未扫码或登录，支付宝侧还没有创建交易。支付链接在 time_expire 之前仍然有效，
+		// 此时关闭本地订单会让之后的付款无处入账，只能等链接过期后再关，订单保持 pending
+		if !order.PayWindowClosed(time.Now()) {
+			logger.Info("cancel_order_pay_window_open", zap.String("order_id", order.ID), zap.Time("expires_at", order.ExpiresAt))
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      "支付链接尚未过期，买家仍可能付款，请在过期后重试或等待系统自动关闭",
+				"expires_at": order.ExpiresAt,
+			})
+			return
+		}
+		action = "local_close"
+	case ealipay.IsTradeStatusError(err):
+		// 交易已支付或已关闭，以支付宝查询结果为准
+		queryResp, queryErr := alipayClient.TradeQueryContext(c.Request.Context(), &ealipay.TradeQueryRequest{OutTradeNo: order.OutTradeNo})
+		if queryErr != nil {
+			logger.Error("cancel_order_trade_query_failed", zap.String("order_id", order.ID), zap.String("error", queryErr.Error()))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "查询支付宝订单失败", "detail": queryErr.Error()})
+			return
+		}
+		switch queryResp.TradeStatus {
+		case "TRADE_CLOSED":
+			action = "already_closed"
+		case "TRADE_SUCCESS", "TRADE_FINISHED":
+			amount, _ := ealipay.ParseAmount(queryResp.TotalAmount)
+			if err := checkTradeMatchesOrder(order, "", "", amount); err != nil {
+				alertTradeMismatch(logger, "cancel", order, queryResp.TradeNo, err)
+				c.JSON(http.StatusConflict, gin.H{"error": "支付宝交易与订单不一致", "detail": err.Error()})
+				return
+			}
+			if err := model.Store.TransitionStatus(order, model.OrderStatusPaid, queryResp.TradeNo, withPaidAt(statusChange(c, model.TransitionSourceAPI), queryResp.SendPayDate)); err != nil {
+				logger.Error("cancel_order_update_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+			}
+			logger.Warn("cancel_order_already_paid", zap.String("order_id", order.ID), zap.String("trade_no", queryResp.TradeNo))
+			c.JSON(http.StatusConflict, gin.H{"error": "订单已支付，不能取消", "alipay_trade_status": queryResp.TradeStatus})
+			return
+		default:
+			c.JSON(http.StatusBadGateway, gin.H{"error": "关闭支付宝订单失败", "detail": err.Error(), "alipay_trade_status": queryResp.TradeStatus})
+			return
+		}
+	case closeResp == nil || ealipay.IsSystemError(err):
+		// 关单结果未知，改用撤销接口：未支付则关闭，已支付则原路退款
+		logger.Warn("cancel_order_trade_close_unknown", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+		cancelResp, cancelErr := alipayClient.TradeCancelContext(c.Request.Context(), &ealipay.TradeCancelRequest{OutTradeNo: order.OutTradeNo})
+		if cancelErr != nil {
+			logger.Error("cancel_order_trade_cancel_failed", zap.String("order_id", order.ID), zap.String("error", cancelErr.Error()))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "撤销支付宝订单失败", "detail": cancelErr.Error()})
+			return
+		}
+		if cancelResp.RetryFlag == "Y" {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "撤销支付宝订单未完成，请重试"})
+			return
+		}
+		action = cancelResp.Action
+		tradeNo = cancelResp.TradeNo
+	default:
+		logger.Error("cancel_order_trade_close_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "关闭支付宝订单失败", "detail": err.Error()})
+		return
 	}
 
-	if err := model.Store.UpdateStatus(order.ID, nextStatus, resp.TradeNo); err != nil {
-		logger.Error("sync_order_update_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+	err = model.Store.TransitionStatus(order, model.OrderStatusClosed, tradeNo, statusChange(c, model.TransitionSourceAPI))
+	if errors.Is(err, model.ErrConcurrentUpdate) {
+		// 关单期间通知或同步已经修改了订单，交由调用方重新查询
+		logger.Warn("cancel_order_conflict", zap.String("order_id", order.ID), zap.String("action", action))
+		c.JSON(http.StatusConflict, gin.H{"error": "订单状态已被其他请求修改，请刷新后重试"})
+		return
+	}
+	if err != nil {
+		logger.Error("cancel_order_update_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单状态失败"})
 		return
 	}
 
 	updated, _ := model.Store.GetByID(order.ID)
-	logger.Info("sync_order_ok", zap.String("order_id", order.ID), zap.String("alipay_trade_status", resp.TradeStatus), zap.String("status", string(nextStatus)))
+	logger.Info("cancel_order_ok", zap.String("order_id", order.ID), zap.String("action", action))
 	c.JSON(http.StatusOK, gin.H{
-		"order":               updated,
-		"alipay_trade_status": resp.TradeStatus,
+		"order":  updated,
+		"action": action,
 	})
 }
 
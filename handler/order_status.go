@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"pay/ealipay"
+	"pay/logging"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// orderStatusFromTrade 把支付宝交易状态映射为订单状态。部分退款后交易仍是 TRADE_SUCCESS，
+// 全额退款后交易变为 TRADE_CLOSED，这两种情况要保留或推进到退款状态，而不是回到 paid / closed。
+func orderStatusFromTrade(current model.OrderStatus, tradeStatus string) model.OrderStatus {
+	refunding := current == model.OrderStatusPaid || current == model.OrderStatusPartiallyRefunded
+	switch tradeStatus {
+	case "WAIT_BUYER_PAY":
+		return model.OrderStatusPending
+	case "TRADE_SUCCESS", "TRADE_FINISHED":
+		if current == model.OrderStatusPartiallyRefunded || current == model.OrderStatusRefunded {
+			return current
+		}
+		return model.OrderStatusPaid
+	case "TRADE_CLOSED":
+		if refunding || current == model.OrderStatusRefunded {
+			return model.OrderStatusRefunded
+		}
+		return model.OrderStatusClosed
+	case "TRADE_FAIL":
+		return model.OrderStatusFailed
+	}
+	return current
+}
+
+func statusChange(c *gin.Context, source model.TransitionSource) model.StatusChange {
+	return model.StatusChange{Source: source, TraceID: logging.TraceIDFromGin(c)}
+}
+
+// withPaidAt 把支付宝返回的付款时间（gmt_payment / send_pay_date）带到状态变更上，
+// 为空或无法解析时保持零值，由存储层取流转的时间。
+func withPaidAt(change model.StatusChange, gmtPayment string) model.StatusChange {
+	if gmtPayment == "" {
+		return change
+	}
+	if t, err := ealipay.ParseTime(gmtPayment); err == nil {
+		change.PaidAt = t
+	}
+	return change
+}
+
+// syncOrderRefundStatus 按已成功的退款合计把订单推进到 partially_refunded 或 refunded。
+func syncOrderRefundStatus(order *model.Order, change model.StatusChange) error {
+	var refunded model.Money
+	for _, r := range model.Refunds.ListByOrderID(order.ID) {
+		if r.Status == model.RefundStatusSuccess {
+			refunded += r.RefundAmount
+		}
+	}
+	if refunded == 0 {
+		return nil
+	}
+
+	status := model.OrderStatusPartiallyRefunded
+	if refunded >= order.TotalAmount {
+		status = model.OrderStatusRefunded
+	}
+	return model.Store.UpdateStatus(order.ID, status, "", change)
+}
+
+var (
+	errTradeMismatch     = errors.New("alipay trade does not match order")
+	errOrderUpdateFailed = errors.New("update order status failed")
+)
+
+type syncResult struct {
+	Order       *model.Order
+	TradeStatus string
+	Detail      string
+}
+
+// syncOrder 查询支付宝交易并把结果应用到订单上，手动同步接口和后台对账共用这一路径。
+// 查询失败时原样返回 ealipay 的错误；交易与订单不一致返回 errTradeMismatch，
+// 并发修改返回 model.ErrConcurrentUpdate，其他写库失败返回 errOrderUpdateFailed。
+func syncOrder(ctx context.Context, logger *zap.Logger, order *model.Order, change model.StatusChange) (*syncResult, error) {
+	resp, err := alipayClient.TradeQueryContext(ctx, &ealipay.TradeQueryRequest{OutTradeNo: order.OutTradeNo})
+	if ealipay.IsTradeNotExist(err) {
+		// 买家尚未扫码或登录，支付宝侧还没有创建交易，订单仍然是待支付
+		logger.Info("sync_order_trade_not_exist", zap.String("order_id", order.ID))
+		return &syncResult{Order: order, Detail: "支付宝交易尚未创建"}, nil
+	}
+	if err != nil {
+		logger.Error("sync_order_trade_query_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	amount, _ := ealipay.ParseAmount(resp.TotalAmount)
+	if err := checkTradeMatchesOrder(order, "", "", amount); err != nil {
+		alertTradeMismatch(logger, string(change.Source), order, resp.TradeNo, err)
+		return nil, fmt.Errorf("%w: %v", errTradeMismatch, err)
+	}
+
+	nextStatus := orderStatusFromTrade(order.Status, resp.TradeStatus)
+	err = model.Store.TransitionStatus(order, nextStatus, resp.TradeNo, withPaidAt(change, resp.SendPayDate))
+	if errors.Is(err, model.ErrConcurrentUpdate) {
+		logger.Warn("sync_order_conflict", zap.String("order_id", order.ID), zap.String("alipay_trade_status", resp.TradeStatus))
+		return nil, err
+	}
+	if errors.Is(err, model.ErrInvalidTransition) {
+		if order.Status == model.OrderStatusClosed && nextStatus == model.OrderStatusPaid {
+			alertPaidAfterClose(logger, string(change.Source), order, resp.TradeNo)
+			return &syncResult{Order: order, TradeStatus: resp.TradeStatus, Detail: "订单已关闭但支付宝交易已支付，需要人工处理"}, nil
+		}
+		logger.Warn("sync_order_stale_status", zap.String("order_id", order.ID), zap.String("alipay_trade_status", resp.TradeStatus), zap.String("error", err.Error()))
+		return &syncResult{Order: order, TradeStatus: resp.TradeStatus, Detail: "订单状态已领先于支付宝交易状态，未更新"}, nil
+	}
+	if err != nil {
+		logger.Error("sync_order_update_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", errOrderUpdateFailed, err)
+	}
+
+	updated, _ := model.Store.GetByID(order.ID)
+	logger.Info("sync_order_ok", zap.String("order_id", order.ID), zap.String("source", string(change.Source)), zap.String("alipay_trade_status", resp.TradeStatus), zap.String("status", string(nextStatus)))
+	return &syncResult{Order: updated, TradeStatus: resp.TradeStatus}, nil
+}
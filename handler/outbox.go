@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"pay/model"
+
+	"go.uber.org/zap"
+)
+
+// EventSink 接收 outbox 中的订单事件。Publish 返回 nil 表示事件已经安全交出。
+// 任一 sink 失败时整条事件稍后重发给所有 sink，实现需要按 EventID 去重或能容忍重复。
+type EventSink interface {
+	Name() string
+	Publish(ctx context.Context, event *model.OrderEvent) error
+}
+
+// OutboxConfig 控制 outbox relay。零值字段使用默认值。
+type OutboxConfig struct {
+	// Interval 是扫描待发布事件的间隔，默认 1 秒
+	Interval time.Duration
+	// BatchSize 是每轮最多发布的事件数，默认 100
+	BatchSize int
+	// Backoff 是第一次发布失败后的等待时间，之后每次翻倍，最长 10 分钟，默认 5 秒
+	Backoff time.Duration
+	Sinks   []EventSink
+}
+
+const (
+	outboxRelayJobLock = "outbox_relay"
+	maxOutboxBackoff   = 10 * time.Minute
+)
+
+func (c OutboxConfig) withDefaults() OutboxConfig {
+	if c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = 5 * time.Second
+	}
+	return c
+}
+
+func (c OutboxConfig) backoff(attempt int) time.Duration {
+	d := c.Backoff
+	for i := 0; i < attempt && d < maxOutboxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxOutboxBackoff {
+		d = maxOutboxBackoff
+	}
+	return d
+}
+
+// StartOutboxRelay 启动 outbox relay：把 order_event 中待发布的事件依次交给所有 sink，全部成功后标记为 sent。
+// 状态更新与事件写入在同一事务中，进程在两者之间崩溃也不会丢事件，代价是事件可能被重复发布。
+// 多个实例中同一时刻只有持有 job_lock 的实例发布。ctx 取消后停止。
+func StartOutboxRelay(ctx context.Context, cfg OutboxConfig) {
+	cfg = cfg.withDefaults()
+	lease := 3 * cfg.Interval
+	if lease < 30*time.Second {
+		lease = 30 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runWithJobLock(ctx, outboxRelayJobLock, lease, func(ctx context.Context, logger *zap.Logger) {
+					relayOrderEvents(ctx, logger, cfg)
+				})
+			}
+		}
+	}()
+}
+
+func relayOrderEvents(ctx context.Context, logger *zap.Logger, cfg OutboxConfig) {
+	for _, event := range model.OrderEvents.ListPending(time.Now(), cfg.BatchSize) {
+		if ctx.Err() != nil {
+			return
+		}
+		relayOrderEvent(ctx, logger, cfg, event)
+	}
+}
+
+func relayOrderEvent(ctx context.Context, logger *zap.Logger, cfg OutboxConfig, event *model.OrderEvent) {
+	logger = logger.With(zap.String("event_id", event.EventID), zap.String("event_type", event.EventType), zap.String("order_id", event.OrderID))
+	for _, sink := range cfg.Sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			next := time.Now().Add(cfg.backoff(event.Attempts))
+			logger.Warn("outbox_publish_failed", zap.String("sink", sink.Name()), zap.Int("attempt", event.Attempts+1), zap.Time("next_attempt_at", next), zap.String("error", err.Error()))
+			if err := model.OrderEvents.MarkFailed(event.ID, sink.Name()+": "+err.Error(), next); err != nil {
+				logger.Error("outbox_mark_failed_failed", zap.String("error", err.Error()))
+			}
+			return
+		}
+	}
+	if err := model.OrderEvents.MarkSent(event.ID); err != nil {
+		// 下一轮会重新发布，sink 需要容忍重复
+		logger.Error("outbox_mark_sent_failed", zap.String("error", err.Error()))
+		return
+	}
+	logger.Debug("outbox_event_sent")
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"pay/model"
+
+	"go.uber.org/zap"
+)
+
+// WebhookSink 把 order.paid、order.closed 和 refund.succeeded 转成商户回调，其他事件忽略。
+// 回调沿用 outbox 的事件 ID，重复发布不会产生重复投递。
+type WebhookSink struct {
+	Logger *zap.Logger
+}
+
+func (s WebhookSink) Name() string { return "webhook" }
+
+func (s WebhookSink) Publish(_ context.Context, event *model.OrderEvent) error {
+	eventType := model.WebhookEventType(event.EventType)
+	switch eventType {
+	case model.WebhookEventOrderPaid, model.WebhookEventOrderClosed:
+		var payload model.OrderEventPayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			return err
+		}
+		return enqueueWebhookEvent(s.Logger, WebhookEvent{
+			ID:        event.EventID,
+			Type:      eventType,
+			CreatedAt: payload.OccurredAt,
+			Data: webhookOrderData{
+				OrderID:         payload.OrderID,
+				OutTradeNo:      payload.OutTradeNo,
+				MerchantOrderNo: payload.MerchantOrderNo,
+				TradeNo:         payload.TradeNo,
+				Status:          payload.Status,
+				TotalAmount:     payload.TotalAmount,
+				Currency:        payload.Currency,
+				Subject:         payload.Subject,
+				PayType:         payload.PayType,
+			},
+		})
+	case model.WebhookEventRefundSucceeded:
+		var payload model.RefundEventPayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			return err
+		}
+		return enqueueWebhookEvent(s.Logger, WebhookEvent{
+			ID:        event.EventID,
+			Type:      eventType,
+			CreatedAt: payload.OccurredAt,
+			Data: webhookRefundData{
+				RefundID:     payload.RefundID,
+				OrderID:      payload.OrderID,
+				OutTradeNo:   payload.OutTradeNo,
+				TradeNo:      payload.TradeNo,
+				OutRequestNo: payload.OutRequestNo,
+				RefundAmount: payload.RefundAmount,
+				Status:       payload.Status,
+			},
+		})
+	}
+	return nil
+}
+
+// LogSink 把每个事件写入日志，便于排查和接入日志采集。
+type LogSink struct {
+	Logger *zap.Logger
+}
+
+func (s LogSink) Name() string { return "log" }
+
+func (s LogSink) Publish(_ context.Context, event *model.OrderEvent) error {
+	s.Logger.Info("order_event_published",
+		zap.String("event_id", event.EventID),
+		zap.String("event_type", event.EventType),
+		zap.String("order_id", event.OrderID),
+		zap.String("from_status", string(event.FromStatus)),
+		zap.String("to_status", string(event.ToStatus)),
+		zap.String("payload", event.Payload),
+	)
+	return nil
+}
+
+// Broker 是消息队列的最小抽象，接入 Kafka、RocketMQ 等时实现它即可。
+type Broker interface {
+	Publish(ctx context.Context, topic, key string, payload []byte) error
+}
+
+// BrokerSink 把事件的 payload 发布到 Topic，以订单 ID 作为分区键，保证同一订单的事件进入同一分区。
+type BrokerSink struct {
+	Broker Broker
+	Topic  string
+}
+
+func (s BrokerSink) Name() string { return "broker" }
+
+func (s BrokerSink) Publish(ctx context.Context, event *model.OrderEvent) error {
+	return s.Broker.Publish(ctx, s.Topic, event.OrderID, []byte(event.Payload))
+}
+
+// LocalBroker 是进程内的 Broker，同步调用订阅者，用于单机部署和调试。
+type LocalBroker struct {
+	mu          sync.RWMutex
+	subscribers map[string][]func(ctx context.Context, key string, payload []byte) error
+}
+
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{subscribers: make(map[string][]func(ctx context.Context, key string, payload []byte) error)}
+}
+
+func (b *LocalBroker) Subscribe(topic string, fn func(ctx context.Context, key string, payload []byte) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[topic] = append(b.subscribers[topic], fn)
+}
+
+// Publish 依次调用订阅者，任一订阅者返回错误时整条消息视为发布失败。
+func (b *LocalBroker) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	b.mu.RLock()
+	subscribers := b.subscribers[topic]
+	b.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		if err := fn(ctx, key, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pay/model"
+
+	"go.uber.org/zap"
+)
+
+func TestWebhookSinkDeliversRefundEventOnce(t *testing.T) {
+	received := make(chan []byte, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Webhook-Event") != string(model.WebhookEventRefundSucceeded) {
+			t.Errorf("X-Webhook-Event = %s", r.Header.Get("X-Webhook-Event"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer receiver.Close()
+
+	endpoint := &model.WebhookEndpoint{URL: receiver.URL, Secret: "test-secret", Events: string(model.WebhookEventRefundSucceeded), Enabled: true}
+	if err := model.Webhooks.CreateEndpoint(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		endpoint.Enabled = false
+		_ = model.Webhooks.UpdateEndpoint(endpoint)
+	})
+
+	refund := &model.Refund{OrderID: "order-sink", OutTradeNo: "otn-sink", OutRequestNo: "req-sink", RefundAmount: 150}
+	if err := model.Refunds.Create(refund); err != nil {
+		t.Fatal(err)
+	}
+	refund.Status = model.RefundStatusSuccess
+	if err := model.Refunds.Update(refund); err != nil {
+		t.Fatal(err)
+	}
+	events := model.OrderEvents.ListByOrderID("order-sink")
+	if len(events) != 1 || events[0].EventType != model.RefundEventSucceeded {
+		t.Fatalf("outbox events = %+v, want one refund.succeeded", events)
+	}
+
+	// relay 失败重试时会再次发布同一事件，商户只收到一次回调
+	sink := WebhookSink{Logger: zap.NewNop()}
+	for i := 0; i < 2; i++ {
+		if err := sink.Publish(context.Background(), events[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case body := <-received:
+		var event struct {
+			ID   string `json:"id"`
+			Data struct {
+				RefundID     string `json:"refund_id"`
+				RefundAmount string `json:"refund_amount"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Fatalf("decode %s: %v", body, err)
+		}
+		if event.ID != events[0].EventID || event.Data.RefundID != refund.ID || event.Data.RefundAmount != "1.50" {
+			t.Fatalf("webhook body = %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("refund webhook not delivered")
+	}
+	select {
+	case body := <-received:
+		t.Fatalf("duplicate webhook delivered: %s", body)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
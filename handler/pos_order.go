@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"pay/ealipay"
+	"pay/logging"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var (
+	posPollInterval   = 3 * time.Second
+	posPollTimeout    = 30 * time.Second
+	posCancelAttempts = 3
+
+	errRetryCancel = errors.New("alipay cancel requires retry")
+)
+
+type CreatePosOrderRequest struct {
+	TotalAmount string `json:"total_amount" binding:"required"`
+	Subject     string `json:"subject" binding:"required"`
+	Body        string `json:"body"`
+	AuthCode    string `json:"auth_code" binding:"required"`
+	StoreId     string `json:"store_id"`
+	TerminalId  string `json:"terminal_id"`
+}
+
+type CreatePosOrderResponse struct {
+	OrderID string            `json:"order_id"`
+	Status  model.OrderStatus `json:"status"`
+	TradeNo string            `json:"trade_no,omitempty"`
+	Detail  string            `json:"detail,omitempty"`
+}
+
+func CreatePosOrder(c *gin.Context) {
+	logger := logging.FromGin(c)
+	var req CreatePosOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Warn("create_pos_order_bad_request", zap.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	amount, ok := parseOrderAmount(c, req.TotalAmount)
+	if !ok {
+		return
+	}
+
+	order := &model.Order{
+		OutTradeNo:  generateOutTradeNo(),
+		TotalAmount: amount,
+		Subject:     req.Subject,
+		Body:        req.Body,
+		PayType:     model.PayTypeBarcode,
+	}
+
+	if err := model.Store.Create(order); err != nil {
+		logger.Error("create_pos_order_store_failed", zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
+		return
+	}
+
+	// 买家已经被扣款时终端断开也必须完成轮询或撤销，因此不继承请求的取消信号
+	ctx := context.WithoutCancel(c.Request.Context())
+	result, err := payByBarcode(ctx, logger, order, &req)
+	if err != nil {
+		logger.Error("create_pos_order_unresolved", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "支付结果未知，请稍后同步订单状态", "order_id": order.ID, "detail": err.Error()})
+		return
+	}
+
+	change := withPaidAt(statusChange(c, model.TransitionSourceAPI), result.GmtPayment)
+	if err := model.Store.UpdateStatus(order.ID, result.Status, result.TradeNo, change); err != nil {
+		logger.Error("create_pos_order_update_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单状态失败"})
+		return
+	}
+
+	logger.Info("create_pos_order_done", zap.String("order_id", order.ID), zap.String("status", string(result.Status)), zap.String("trade_no", result.TradeNo))
+	c.JSON(http.StatusOK, CreatePosOrderResponse{
+		OrderID: order.ID,
+		Status:  result.Status,
+		TradeNo: result.TradeNo,
+		Detail:  result.Detail,
+	})
+}
+
+// barcodeResult 是付款码支付的最终结果，GmtPayment 是支付宝返回的付款时间，未支付时为空。
+type barcodeResult struct {
+	Status     model.OrderStatus
+	TradeNo    string
+	Detail     string
+	GmtPayment string
+}
+
+// payByBarcode 按支付宝付款码支付的接入要求处理结果：10003/20000 或网络异常时轮询查询，
+// 超时仍未支付则撤销交易。只有撤销也无法确认结果时才返回 error，订单保持 pending。
+func payByBarcode(ctx context.Context, logger *zap.Logger, order *model.Order, req *CreatePosOrderRequest) (*barcodeResult, error) {
+	resp, err := alipayClient.TradePayContext(ctx, &ealipay.TradePayRequest{
+		OutTradeNo:  order.OutTradeNo,
+		AuthCode:    req.AuthCode,
+		TotalAmount: order.TotalAmount.String(),
+		Subject:     order.Subject,
+		Body:        order.Body,
+		StoreId:     req.StoreId,
+		TerminalId:  req.TerminalId,
+	})
+	switch {
+	case err == nil && resp.Code == ealipay.CodeSuccess:
+		return &barcodeResult{Status: model.OrderStatusPaid, TradeNo: resp.TradeNo, GmtPayment: resp.GmtPayment}, nil
+	case errors.Is(err, ealipay.ErrCircuitOpen):
+		return &barcodeResult{Status: model.OrderStatusFailed, Detail: err.Error()}, nil
+	case err != nil && resp != nil && !ealipay.IsSystemError(err):
+		return &barcodeResult{Status: model.OrderStatusFailed, TradeNo: resp.TradeNo, Detail: err.Error()}, nil
+	}
+
+	if err != nil {
+		logger.Warn("pos_order_pay_unknown", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+	}
+
+	deadline := time.Now().Add(posPollTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(posPollInterval)
+
+		queryResp, queryErr := alipayClient.TradeQueryContext(ctx, &ealipay.TradeQueryRequest{OutTradeNo: order.OutTradeNo})
+		if queryErr != nil {
+			logger.Warn("pos_order_poll_failed", zap.String("order_id", order.ID), zap.String("error", queryErr.Error()))
+			continue
+		}
+		switch queryResp.TradeStatus {
+		case "TRADE_SUCCESS", "TRADE_FINISHED":
+			return &barcodeResult{Status: model.OrderStatusPaid, TradeNo: queryResp.TradeNo, GmtPayment: queryResp.SendPayDate}, nil
+		case "TRADE_CLOSED":
+			return &barcodeResult{Status: model.OrderStatusClosed, TradeNo: queryResp.TradeNo, Detail: "交易已关闭"}, nil
+		}
+	}
+
+	var lastErr error
+	for i := 0; i < posCancelAttempts; i++ {
+		cancelResp, cancelErr := alipayClient.TradeCancelContext(ctx, &ealipay.TradeCancelRequest{OutTradeNo: order.OutTradeNo})
+		if cancelErr == nil && cancelResp.RetryFlag != "Y" {
+			logger.Info("pos_order_cancelled", zap.String("order_id", order.ID), zap.String("action", cancelResp.Action))
+			return &barcodeResult{Status: model.OrderStatusClosed, TradeNo: cancelResp.TradeNo, Detail: "等待买家付款超时，交易已撤销"}, nil
+		}
+		lastErr = cancelErr
+		if lastErr == nil {
+			lastErr = errRetryCancel
+		}
+		time.Sleep(posPollInterval)
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"pay/ealipay"
+	"pay/logging"
+	"pay/model"
+
+	"go.uber.org/zap"
+)
+
+// ReconcilerConfig 控制后台对账任务。零值字段使用默认值。
+type ReconcilerConfig struct {
+	// Interval 是扫描到期订单的间隔，默认 10 秒
+	Interval time.Duration
+	// Concurrency 是同时查询支付宝的订单数，默认 4
+	Concurrency int
+	// BatchSize 是每轮最多处理的订单数，默认 100
+	BatchSize int
+	// Backoff 是第 N 次查询之后到下一次查询的等待时间，超出长度时沿用最后一项，默认 15s、1m、5m、30m
+	Backoff []time.Duration
+}
+
+var defaultReconcileBackoff = []time.Duration{15 * time.Second, time.Minute, 5 * time.Minute, 30 * time.Minute}
+
+func (c ReconcilerConfig) withDefaults() ReconcilerConfig {
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 4
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if len(c.Backoff) == 0 {
+		c.Backoff = defaultReconcileBackoff
+	}
+	return c
+}
+
+func (c ReconcilerConfig) backoff(attempt int) time.Duration {
+	if attempt >= len(c.Backoff) {
+		attempt = len(c.Backoff) - 1
+	}
+	return c.Backoff[attempt]
+}
+
+const reconcilerJobLock = "order_reconciler"
+
+// StartReconciler 启动后台对账：按退避计划查询仍是 pending 的订单，丢失的异步通知也能被补上；
+// 超过 ExpiresAt 和 model.OrderExpireGrace 仍未支付的订单调用关单接口。多个实例中同一时刻只有持有 job_lock 的实例扫描，
+// 租约失效的瞬间仍由 model.OrderStore.ClaimReconcile 保证每笔订单每轮只被处理一次。ctx 取消后停止。
+func StartReconciler(ctx context.Context, cfg ReconcilerConfig) {
+	cfg = cfg.withDefaults()
+	lease := 3 * cfg.Interval
+	if lease < 30*time.Second {
+		lease = 30 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runWithJobLock(ctx, reconcilerJobLock, lease, func(ctx context.Context, logger *zap.Logger) {
+					reconcileDueOrders(ctx, logger, cfg)
+				})
+			}
+		}
+	}()
+}
+
+func reconcileDueOrders(ctx context.Context, logger *zap.Logger, cfg ReconcilerConfig) {
+	now := time.Now()
+	sem := make(chan struct{}, cfg.Concurrency)
+	var wg sync.WaitGroup
+	for _, order := range model.Store.ListDueForReconcile(now, cfg.BatchSize) {
+		claimed, err := model.Store.ClaimReconcile(order.ID, order.ReconcileAttempts, now.Add(cfg.backoff(order.ReconcileAttempts)))
+		if err != nil {
+			logger.Error("reconcile_claim_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(order *model.Order) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			reconcileOrder(ctx, logger, order)
+		}(order)
+	}
+	wg.Wait()
+}
+
+func reconcileOrder(ctx context.Context, logger *zap.Logger, order *model.Order) {
+	ctx, traceID := logging.WithNewTraceID(ctx)
+	logger = logger.With(zap.String("trace_id", traceID), zap.String("job", "reconcile"))
+	change := model.StatusChange{Source: model.TransitionSourceJob, TraceID: traceID}
+
+	result, err := syncOrder(ctx, logger, order, change)
+	if err != nil {
+		// 下次到期时重试，syncOrder 已经记录了日志
+		return
+	}
+	// 过期后再等 OrderExpireGrace：与支付宝的时钟偏差或 time_expire 前一刻发起的支付仍可能成功
+	if result.Order.Status != model.OrderStatusPending || !result.Order.PayWindowClosed(time.Now()) {
+		return
+	}
+	closeExpiredOrder(ctx, logger, result.Order, change)
+}
+
+// closeExpiredOrder 关闭超时未支付的订单。关单时交易已支付或已关闭，则再同步一次以支付宝状态为准。
+func closeExpiredOrder(ctx context.Context, logger *zap.Logger, order *model.Order, change model.StatusChange) {
+	change.Reason = "expired"
+	action := "close"
+	tradeNo := ""
+	resp, err := alipayClient.TradeCloseContext(ctx, &ealipay.TradeCloseRequest{OutTradeNo: order.OutTradeNo})
+	switch {
+	case err == nil:
+		tradeNo = resp.TradeNo
+	case ealipay.IsTradeNotExist(err):
+		// 买家始终没有扫码，支付宝侧没有交易；支付链接已经过期，可以只关闭本地订单
+		action = "local_close"
+	case ealipay.IsTradeStatusError(err):
+		_, _ = syncOrder(ctx, logger, order, change)
+		return
+	default:
+		logger.Warn("reconcile_close_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+		return
+	}
+
+	err = model.Store.TransitionStatus(order, model.OrderStatusClosed, tradeNo, change)
+	if errors.Is(err, model.ErrConcurrentUpdate) {
+		logger.Info("reconcile_close_conflict", zap.String("order_id", order.ID))
+		return
+	}
+	if err != nil {
+		logger.Error("reconcile_close_update_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+		return
+	}
+	logger.Info("reconcile_order_closed", zap.String("order_id", order.ID), zap.String("action", action))
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestReconcilerWaitsForGraceBeforeLocalClose(t *testing.T) {
+	srv, app := newTestApp(t)
+
+	order := createTestOrder(t, app, "1.00", string(model.PayTypePage))
+
+	// 刚过 time_expire，仍在宽限期内
+	order.ExpiresAt = time.Now().Add(-time.Minute)
+	reconcileOrder(context.Background(), zap.NewNop(), order)
+	if got, _ := model.Store.GetByID(order.ID); got.Status != model.OrderStatusPending {
+		t.Fatalf("status within grace = %s, want pending", got.Status)
+	}
+
+	order.ExpiresAt = time.Now().Add(-model.OrderExpireGrace - time.Minute)
+	reconcileOrder(context.Background(), zap.NewNop(), order)
+	got, _ := model.Store.GetByID(order.ID)
+	if got.Status != model.OrderStatusClosed {
+		t.Fatalf("status after grace = %s, want closed", got.Status)
+	}
+
+	// 关单之后支付宝仍然收款：订单保持 closed，通知被确认，不会被重新打开
+	if _, err := srv.Pay(order.OutTradeNo, "1.00"); err != nil {
+		t.Fatal(err)
+	}
+	ack, err := srv.Notify(context.Background(), order.OutTradeNo)
+	if err != nil || ack != "success" {
+		t.Fatalf("late notify ack = %q, %v; want success", ack, err)
+	}
+	var synced struct {
+		Order  *model.Order `json:"order"`
+		Detail string       `json:"detail"`
+	}
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/sync", gin.H{}, &synced); code != http.StatusOK {
+		t.Fatalf("sync status = %d", code)
+	}
+	if synced.Order.Status != model.OrderStatusClosed || synced.Detail == "" {
+		t.Fatalf("sync = %s %q, want closed with detail", synced.Order.Status, synced.Detail)
+	}
+}
@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"pay/ealipay"
+	"pay/logging"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type CreateRefundRequest struct {
+	RefundAmount string `json:"refund_amount" binding:"required"`
+	RefundReason string `json:"refund_reason"`
+	OutRequestNo string `json:"out_request_no"`
+}
+
+func CreateRefund(c *gin.Context) {
+	logger := logging.FromGin(c)
+	orderID := c.Param("id")
+
+	var req CreateRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Warn("create_refund_bad_request", zap.String("error", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, exists := model.Store.GetByID(orderID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	if order.Status != model.OrderStatusPaid && order.Status != model.OrderStatusPartiallyRefunded {
+		c.JSON(http.StatusConflict, gin.H{"error": "订单未支付或已全额退款，不能退款"})
+		return
+	}
+
+	refundAmount, err := model.ParseMoney(req.RefundAmount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的退款金额", "detail": err.Error()})
+		return
+	}
+
+	var refund *model.Refund
+	if req.OutRequestNo != "" {
+		if existing, ok := model.Refunds.GetByOutRequestNo(req.OutRequestNo); ok {
+			if existing.OrderID != order.ID || existing.RefundAmount != refundAmount {
+				c.JSON(http.StatusConflict, gin.H{"error": "out_request_no 已被其他退款使用"})
+				return
+			}
+			if existing.Status == model.RefundStatusSuccess {
+				c.JSON(http.StatusOK, existing)
+				return
+			}
+			refund = existing
+		}
+	}
+
+	// reserved 表示本次请求新登记了退款（新建或重新发起已失败的退款），此前没有发出过的请求在等待结果。
+	// 已经是 pending / processing 的退款在登记时已经占用了余额，直接用同一个 out_request_no 重试
+	reserved := refund == nil || refund.Status == model.RefundStatusFailed
+	if reserved {
+		if refund == nil {
+			outRequestNo := req.OutRequestNo
+			if outRequestNo == "" {
+				outRequestNo = generateOutTradeNo()
+			}
+			refund = &model.Refund{
+				OrderID:      order.ID,
+				OutTradeNo:   order.OutTradeNo,
+				TradeNo:      order.TradeNo,
+				OutRequestNo: outRequestNo,
+				RefundAmount: refundAmount,
+				RefundReason: req.RefundReason,
+			}
+		}
+		refundable, err := model.Refunds.Reserve(refund, order.TotalAmount)
+		if errors.Is(err, model.ErrRefundExceedsBalance) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":      "退款金额超过可退余额",
+				"refundable": refundable,
+			})
+			return
+		}
+		if errors.Is(err, model.ErrConcurrentUpdate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "退款正在处理中，请稍后同步退款状态"})
+			return
+		}
+		if err != nil {
+			logger.Error("create_refund_store_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建退款记录失败"})
+			return
+		}
+	}
+
+	err = sendRefund(c.Request.Context(), refund, reserved)
+	if updateErr := model.Refunds.Update(refund); updateErr != nil {
+		logger.Error("create_refund_update_failed", zap.String("refund_id", refund.ID), zap.String("error", updateErr.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新退款记录失败"})
+		return
+	}
+
+	if refund.Status == model.RefundStatusSuccess {
+		if err := syncOrderRefundStatus(order, statusChange(c, model.TransitionSourceAPI)); err != nil {
+			logger.Error("create_refund_order_update_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+		}
+	}
+
+	if err != nil {
+		logger.Error("create_refund_trade_refund_failed", zap.String("order_id", order.ID), zap.String("refund_id", refund.ID), zap.String("status", string(refund.Status)), zap.String("error", err.Error()))
+		status := http.StatusBadGateway
+		if errors.Is(err, ealipay.ErrCircuitOpen) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": "支付宝退款失败", "detail": err.Error(), "refund": refund})
+		return
+	}
+
+	logger.Info("create_refund_ok", zap.String("order_id", order.ID), zap.String("refund_id", refund.ID), zap.String("out_request_no", refund.OutRequestNo), zap.Stringer("refund_amount", refund.RefundAmount), zap.String("status", string(refund.Status)))
+	c.JSON(http.StatusOK, refund)
+}
+
+// sendRefund 用退款记录的 out_request_no 调用退款接口，并把结果写回 refund（不保存）。
+// 只有支付宝明确拒绝时才记为 failed；结果未知时保持 processing，由同步接口用同一个 out_request_no 重试。
+// reserved 表示退款是本次请求登记的，此前没有发出过。
+func sendRefund(ctx context.Context, refund *model.Refund, reserved bool) error {
+	resp, err := alipayClient.TradeRefundContext(ctx, &ealipay.TradeRefundRequest{
+		OutTradeNo:   refund.OutTradeNo,
+		TradeNo:      refund.TradeNo,
+		RefundAmount: refund.RefundAmount.String(),
+		RefundReason: refund.RefundReason,
+		OutRequestNo: refund.OutRequestNo,
+	})
+	switch {
+	case errors.Is(err, ealipay.ErrCircuitOpen):
+		// 请求没有发出。本次登记的退款可以直接记为失败；之前已经发出过的退款结果仍未知，
+		// 记为失败会让这笔金额被再次退款，因此保持原状态等待同步
+		if reserved {
+			refund.Status = model.RefundStatusFailed
+			refund.ErrorMsg = err.Error()
+		}
+	case err != nil && (resp == nil || ealipay.IsSystemError(err)):
+		// 网络错误、超时或支付宝系统繁忙，退款结果未知，保持 processing 等待同步
+		refund.Status = model.RefundStatusProcessing
+		refund.ErrorMsg = err.Error()
+	case err != nil:
+		refund.Status = model.RefundStatusFailed
+		refund.ErrorCode = resp.SubCode
+		refund.ErrorMsg = err.Error()
+	default:
+		if resp.TradeNo != "" {
+			refund.TradeNo = resp.TradeNo
+		}
+		refund.FundChange = resp.FundChange
+		refund.ErrorCode = ""
+		refund.ErrorMsg = ""
+		refund.Status = model.RefundStatusProcessing
+		if resp.FundChange == "Y" {
+			refund.Status = model.RefundStatusSuccess
+		}
+	}
+	return err
+}
+
+func SyncRefundStatus(c *gin.Context) {
+	logger := logging.FromGin(c)
+	orderID := c.Param("id")
+	refundID := c.Param("refund_id")
+
+	refund, exists := model.Refunds.GetByID(refundID)
+	if !exists || refund.OrderID != orderID {
+		logger.Warn("sync_refund_not_found", zap.String("order_id", orderID), zap.String("refund_id", refundID))
+		c.JSON(http.StatusNotFound, gin.H{"error": "退款记录不存在"})
+		return
+	}
+
+	resp, err := alipayClient.TradeRefundQueryContext(c.Request.Context(), &ealipay.TradeRefundQueryRequest{
+		OutTradeNo:   refund.OutTradeNo,
+		TradeNo:      refund.TradeNo,
+		OutRequestNo: refund.OutRequestNo,
+		QueryOptions: []string{"gmt_refund_pay"},
+	})
+	if err != nil {
+		logger.Error("sync_refund_query_failed", zap.String("refund_id", refund.ID), zap.String("error", err.Error()))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "查询支付宝退款失败", "detail": err.Error()})
+		return
+	}
+
+	var refundErr error
+	if resp.Refunded() {
+		refund.Status = model.RefundStatusSuccess
+		refund.ErrorCode = ""
+		refund.ErrorMsg = ""
+		if resp.TradeNo != "" {
+			refund.TradeNo = resp.TradeNo
+		}
+	} else if refund.Status == model.RefundStatusPending || refund.Status == model.RefundStatusProcessing {
+		// 查询不到退款不代表失败，退款请求可能还没有到达支付宝。按支付宝的约定用同一个
+		// out_request_no 重新发起，由退款接口给出明确结果
+		refundErr = sendRefund(c.Request.Context(), refund, false)
+		if refundErr != nil {
+			logger.Warn("sync_refund_retry_failed", zap.String("refund_id", refund.ID), zap.String("status", string(refund.Status)), zap.String("error", refundErr.Error()))
+		}
+	}
+
+	if err := model.Refunds.Update(refund); err != nil {
+		logger.Error("sync_refund_update_failed", zap.String("refund_id", refund.ID), zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新退款记录失败"})
+		return
+	}
+
+	if refund.Status == model.RefundStatusSuccess {
+		if order, ok := model.Store.GetByID(refund.OrderID); ok {
+			if err := syncOrderRefundStatus(order, statusChange(c, model.TransitionSourceSync)); err != nil {
+				logger.Error("sync_refund_order_update_failed", zap.String("order_id", order.ID), zap.String("error", err.Error()))
+			}
+		}
+	}
+
+	updated, _ := model.Refunds.GetByID(refund.ID)
+	if refundErr != nil && refund.Status != model.RefundStatusFailed {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "重新发起退款结果未知，请稍后再同步", "detail": refundErr.Error(), "refund": updated})
+		return
+	}
+	logger.Info("sync_refund_ok", zap.String("refund_id", refund.ID), zap.String("alipay_refund_status", resp.RefundStatus), zap.String("status", string(refund.Status)))
+	c.JSON(http.StatusOK, gin.H{
+		"refund":               updated,
+		"alipay_refund_status": resp.RefundStatus,
+	})
+}
+
+func ListRefunds(c *gin.Context) {
+	orderID := c.Param("id")
+
+	if _, exists := model.Store.GetByID(orderID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Refunds.ListByOrderID(orderID))
+}
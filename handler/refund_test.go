@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pay/ealipay"
+	"pay/ealipay/alipaytest"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createPaidTestOrder 创建页面支付订单，模拟买家付款后同步为 paid。
+func createPaidTestOrder(t *testing.T, srv *alipaytest.Server, app *httptest.Server, amount string) *model.Order {
+	t.Helper()
+	order := createTestOrder(t, app, amount, string(model.PayTypePage))
+	if _, err := srv.Pay(order.OutTradeNo, amount); err != nil {
+		t.Fatal(err)
+	}
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/sync", nil, nil); code != http.StatusOK {
+		t.Fatalf("sync status = %d", code)
+	}
+	paid, _ := model.Store.GetByID(order.ID)
+	if paid.Status != model.OrderStatusPaid {
+		t.Fatalf("status = %s, want paid", paid.Status)
+	}
+	return paid
+}
+
+func TestRefundCircuitOpenKeepsProcessingRefund(t *testing.T) {
+	srv, app := newTestApp(t)
+	cfg := srv.Config()
+	cfg.Retry = ealipay.RetryPolicy{MaxAttempts: 1}
+	cfg.CircuitBreaker = ealipay.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Hour}
+	if err := InitAlipayClient(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	order := createPaidTestOrder(t, srv, app, "10.00")
+
+	// 支付宝系统繁忙，退款结果未知；这次失败同时让熔断器打开
+	srv.FailNext("alipay.trade.refund", ealipay.Error{Code: ealipay.CodeUnknownError, Msg: "Service Currently Unavailable", SubCode: ealipay.SubCodeSystemError})
+	body := gin.H{"refund_amount": "10.00", "out_request_no": "refund-circuit-" + order.ID}
+	var first struct {
+		Refund *model.Refund `json:"refund"`
+	}
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds", body, &first); code != http.StatusBadGateway {
+		t.Fatalf("first refund status = %d, want 502", code)
+	}
+	if first.Refund.Status != model.RefundStatusProcessing {
+		t.Fatalf("first refund = %s, want processing", first.Refund.Status)
+	}
+
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds", body, nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("retry with circuit open status = %d, want 503", code)
+	}
+	if got, _ := model.Refunds.GetByID(first.Refund.ID); got.Status != model.RefundStatusProcessing {
+		t.Fatalf("refund after circuit open = %s, want processing", got.Status)
+	}
+
+	// 结果未知的退款仍然占用可退余额
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds", gin.H{"refund_amount": "10.00"}, nil); code != http.StatusBadRequest {
+		t.Fatalf("second refund status = %d, want 400", code)
+	}
+}
+
+func TestSyncRefundRetriesRefundNotFound(t *testing.T) {
+	srv, app := newTestApp(t)
+	cfg := srv.Config()
+	cfg.Retry = ealipay.RetryPolicy{MaxAttempts: 1}
+	if err := InitAlipayClient(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	order := createPaidTestOrder(t, srv, app, "10.00")
+	systemError := ealipay.Error{Code: ealipay.CodeUnknownError, Msg: "Service Currently Unavailable", SubCode: ealipay.SubCodeSystemError}
+
+	createProcessing := func(amount string) *model.Refund {
+		t.Helper()
+		srv.FailNext("alipay.trade.refund", systemError)
+		var created struct {
+			Refund *model.Refund `json:"refund"`
+		}
+		if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds", gin.H{"refund_amount": amount}, &created); code != http.StatusBadGateway {
+			t.Fatalf("refund status = %d, want 502", code)
+		}
+		if created.Refund.Status != model.RefundStatusProcessing {
+			t.Fatalf("refund = %s, want processing", created.Refund.Status)
+		}
+		return created.Refund
+	}
+	var synced struct {
+		Refund *model.Refund `json:"refund"`
+	}
+
+	// 退款请求没有到达支付宝，查询不到退款：用同一个 out_request_no 重新发起后成功
+	refund := createProcessing("4.00")
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds/"+refund.ID+"/sync", nil, &synced); code != http.StatusOK {
+		t.Fatalf("sync status = %d", code)
+	}
+	if synced.Refund.Status != model.RefundStatusSuccess {
+		t.Fatalf("synced refund = %s, want success", synced.Refund.Status)
+	}
+	if trade, _ := srv.Trade(order.OutTradeNo); trade.RefundedFee != 400 || trade.Refunds[refund.OutRequestNo] == "" {
+		t.Fatalf("gateway refunds = %v, want %s refunded", trade.Refunds, refund.OutRequestNo)
+	}
+
+	// 重新发起时支付宝仍然繁忙，退款保持 processing
+	refund = createProcessing("6.00")
+	srv.FailNext("alipay.trade.refund", systemError)
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds/"+refund.ID+"/sync", nil, &synced); code != http.StatusBadGateway {
+		t.Fatalf("sync while busy status = %d, want 502", code)
+	}
+	if got, _ := model.Refunds.GetByID(refund.ID); got.Status != model.RefundStatusProcessing {
+		t.Fatalf("refund while busy = %s, want processing", got.Status)
+	}
+
+	// 支付宝明确拒绝后才记为 failed
+	srv.FailNext("alipay.trade.refund", ealipay.Error{Code: "40004", Msg: "Business Failed", SubCode: "ACQ.TRADE_STATUS_ERROR", SubMsg: "交易状态不合法"})
+	if code := postJSON(t, app.URL+"/api/orders/"+order.ID+"/refunds/"+refund.ID+"/sync", nil, &synced); code != http.StatusOK {
+		t.Fatalf("sync after rejection status = %d", code)
+	}
+	if synced.Refund.Status != model.RefundStatusFailed || synced.Refund.ErrorCode != "ACQ.TRADE_STATUS_ERROR" {
+		t.Fatalf("refund after rejection = %s %s, want failed", synced.Refund.Status, synced.Refund.ErrorCode)
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"pay/ealipay"
+	"pay/logging"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type CreateWapOrderRequest struct {
+	TotalAmount string `json:"total_amount" binding:"required"`
+	Subject     string `json:"subject" binding:"required"`
+	Body        string `json:"body"`
+}
+
+type CreateWapOrderResponse struct {
+	OrderID string `json:"order_id"`
+	PayURL  string `json:"pay_url"`
+}
+
+func CreateWapOrder(c *gin.Context) {
+	logger := logging.FromGin(c)
+	var req CreateWapOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	amount, ok := parseOrderAmount(c, req.TotalAmount)
+	if !ok {
+		return
+	}
+
+	order := &model.Order{
+		OutTradeNo:  generateOutTradeNo(),
+		TotalAmount: amount,
+		Subject:     req.Subject,
+		Body:        req.Body,
+		PayType:     model.PayTypeWap,
+	}
+
+	if err := model.Store.Create(order); err != nil {
+		logger.Error("create_wap_order_store_failed", zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
+		return
+	}
+
+	payURL, err := alipayClient.WapPay(&ealipay.WapPayRequest{
+		OutTradeNo:  order.OutTradeNo,
+		TotalAmount: order.TotalAmount.String(),
+		Subject:     order.Subject,
+		Body:        order.Body,
+		TimeExpire:  ealipay.FormatTime(order.ExpiresAt),
+	})
+	if err != nil {
+		logger.Error("create_wap_order_wap_pay_failed", zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成支付链接失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CreateWapOrderResponse{
+		OrderID: order.ID,
+		PayURL:  payURL,
+	})
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pay/logging"
+	"pay/model"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type CreateWebhookEndpointRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+}
+
+type UpdateWebhookEndpointRequest struct {
+	URL         *string  `json:"url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url 必须是 http 或 https 地址")
+	}
+	return nil
+}
+
+func normalizeWebhookEvents(events []string) (string, error) {
+	for _, e := range events {
+		known := false
+		for _, t := range model.WebhookEventTypes {
+			if model.WebhookEventType(e) == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return "", errors.New("不支持的事件类型: " + e)
+		}
+	}
+	return strings.Join(events, ","), nil
+}
+
+// CreateWebhookEndpoint 登记回调地址，签名密钥只在这里返回一次。
+func CreateWebhookEndpoint(c *gin.Context) {
+	var req CreateWebhookEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhookURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	endpoint := &model.WebhookEndpoint{
+		URL:         req.URL,
+		Secret:      model.NewWebhookSecret(),
+		Events:      events,
+		Description: req.Description,
+		Enabled:     true,
+	}
+	if err := model.Webhooks.CreateEndpoint(endpoint); err != nil {
+		logging.FromGin(c).Error("create_webhook_endpoint_failed", zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建回调地址失败"})
+		return
+	}
+
+	logging.FromGin(c).Info("create_webhook_endpoint_ok", zap.String("endpoint_id", endpoint.ID), zap.String("url", endpoint.URL))
+	c.JSON(http.StatusOK, gin.H{"endpoint": endpoint, "secret": endpoint.Secret})
+}
+
+func ListWebhookEndpoints(c *gin.Context) {
+	c.JSON(http.StatusOK, model.Webhooks.ListEndpoints())
+}
+
+func UpdateWebhookEndpoint(c *gin.Context) {
+	endpoint, exists := model.Webhooks.GetEndpoint(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回调地址不存在"})
+		return
+	}
+
+	var req UpdateWebhookEndpointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		endpoint.URL = *req.URL
+	}
+	if req.Events != nil {
+		events, err := normalizeWebhookEvents(req.Events)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		endpoint.Events = events
+	}
+	if req.Description != nil {
+		endpoint.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		endpoint.Enabled = *req.Enabled
+	}
+
+	if err := model.Webhooks.UpdateEndpoint(endpoint); err != nil {
+		logging.FromGin(c).Error("update_webhook_endpoint_failed", zap.String("endpoint_id", endpoint.ID), zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新回调地址失败"})
+		return
+	}
+	c.JSON(http.StatusOK, endpoint)
+}
+
+func ListWebhookDeliveries(c *gin.Context) {
+	endpointID := c.Param("id")
+	if _, exists := model.Webhooks.GetEndpoint(endpointID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回调地址不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, model.Webhooks.ListDeliveries(endpointID, 100))
+}
+
+// GetWebhookDelivery 返回投递及其每一次发送的记录。
+func GetWebhookDelivery(c *gin.Context) {
+	delivery, exists := model.Webhooks.GetDelivery(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投递记录不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"delivery": delivery,
+		"attempts": model.Webhooks.ListAttempts(delivery.ID),
+	})
+}
+
+// RedeliverWebhook 立即重新发送一次投递。已经用尽重试次数的投递只会再发送这一次，失败后仍为 failed。
+func RedeliverWebhook(c *gin.Context) {
+	logger := logging.FromGin(c)
+
+	delivery, err := model.Webhooks.Redeliver(c.Param("id"))
+	if errors.Is(err, model.ErrWebhookNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投递记录不存在"})
+		return
+	}
+	if err != nil {
+		logger.Error("redeliver_webhook_failed", zap.String("delivery_id", c.Param("id")), zap.String("error", err.Error()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新投递失败"})
+		return
+	}
+
+	deliverWebhook(c.Request.Context(), logger, webhookConfig, delivery)
+
+	updated, _ := model.Webhooks.GetDelivery(delivery.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"delivery": updated,
+		"attempts": model.Webhooks.ListAttempts(delivery.ID),
+	})
+}
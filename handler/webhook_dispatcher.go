@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"pay/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	webhookHeaderID        = "X-Webhook-Id"
+	webhookHeaderEvent     = "X-Webhook-Event"
+	webhookHeaderTimestamp = "X-Webhook-Timestamp"
+	webhookHeaderSignature = "X-Webhook-Signature"
+)
+
+// 投递日志中保留的响应体长度
+const maxWebhookResponseLog = 1024
+
+// WebhookConfig 控制商户回调的投递与重试。零值字段使用默认值。
+type WebhookConfig struct {
+	// Interval 是扫描待重试投递的间隔，默认 5 秒
+	Interval time.Duration
+	// Concurrency 是同时进行的投递数，默认 4
+	Concurrency int
+	// BatchSize 是每轮最多处理的投递数，默认 100
+	BatchSize int
+	// MaxAttempts 是自动投递的最多次数，用尽后标记为 failed，默认 10
+	MaxAttempts int
+	// Timeout 是单次 HTTP 请求的超时，默认 10 秒
+	Timeout time.Duration
+	// Backoff 是第一次失败后的等待时间，之后每次翻倍，最长 6 小时，默认 30 秒
+	Backoff time.Duration
+}
+
+const maxWebhookBackoff = 6 * time.Hour
+
+func (c WebhookConfig) withDefaults() WebhookConfig {
+	if c.Interval <= 0 {
+		c.Interval = 5 * time.Second
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 4
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 10
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = 30 * time.Second
+	}
+	return c
+}
+
+func (c WebhookConfig) backoff(attempt int) time.Duration {
+	d := c.Backoff
+	for i := 0; i < attempt && d < maxWebhookBackoff; i++ {
+		d *= 2
+	}
+	if d > maxWebhookBackoff {
+		d = maxWebhookBackoff
+	}
+	return d
+}
+
+var (
+	webhookConfig     = WebhookConfig{}.withDefaults()
+	webhookHTTPClient = &http.Client{Timeout: webhookConfig.Timeout}
+)
+
+// WebhookEvent 是投递给商户的事件信封，签名覆盖整个 JSON 请求体。
+type WebhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      model.WebhookEventType `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      any                    `json:"data"`
+}
+
+type webhookOrderData struct {
+	OrderID         string            `json:"order_id"`
+	OutTradeNo      string            `json:"out_trade_no"`
+	MerchantOrderNo string            `json:"merchant_order_no,omitempty"`
+	TradeNo         string            `json:"trade_no,omitempty"`
+	Status          model.OrderStatus `json:"status"`
+	TotalAmount     model.Money       `json:"total_amount"`
+	Currency        model.Currency    `json:"currency"`
+	Subject         string            `json:"subject"`
+	PayType         model.PayType     `json:"pay_type"`
+}
+
+type webhookRefundData struct {
+	RefundID     string             `json:"refund_id"`
+	OrderID      string             `json:"order_id"`
+	OutTradeNo   string             `json:"out_trade_no"`
+	TradeNo      string             `json:"trade_no,omitempty"`
+	OutRequestNo string             `json:"out_request_no"`
+	RefundAmount model.Money        `json:"refund_amount"`
+	Status       model.RefundStatus `json:"status"`
+}
+
+// StartWebhookDispatcher 启动后台投递：按退避计划重试未成功的商户回调。多个实例中同一时刻只有持有
+// job_lock 的实例扫描，model.WebhookStore.ClaimDelivery 保证每次投递只被发送一次。ctx 取消后停止。
+func StartWebhookDispatcher(ctx context.Context, cfg WebhookConfig) {
+	cfg = cfg.withDefaults()
+	webhookConfig = cfg
+	webhookHTTPClient = &http.Client{Timeout: cfg.Timeout}
+	lease := 3 * cfg.Interval
+	if lease < 30*time.Second {
+		lease = 30 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runWithJobLock(ctx, "webhook_dispatcher", lease, func(ctx context.Context, logger *zap.Logger) {
+					dispatchDueWebhooks(ctx, logger, cfg)
+				})
+			}
+		}
+	}()
+}
+
+func dispatchDueWebhooks(ctx context.Context, logger *zap.Logger, cfg WebhookConfig) {
+	sem := make(chan struct{}, cfg.Concurrency)
+	var wg sync.WaitGroup
+	for _, delivery := range model.Webhooks.ListDueDeliveries(time.Now(), cfg.BatchSize) {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(delivery *model.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			deliverWebhook(ctx, logger, cfg, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+// enqueueWebhookEvent 为每个订阅了该事件的回调地址保存一条投递并立即尝试发送，
+// 发送失败的由 StartWebhookDispatcher 按退避计划重试。同一事件重复入队不会产生重复投递。
+func enqueueWebhookEvent(logger *zap.Logger, event WebhookEvent) error {
+	eventType := event.Type
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []*model.WebhookDelivery
+	for _, endpoint := range model.Webhooks.ListEndpoints() {
+		if !endpoint.Enabled || !endpoint.Subscribes(eventType) {
+			continue
+		}
+		deliveries = append(deliveries, &model.WebhookDelivery{
+			EndpointID: endpoint.ID,
+			EventID:    event.ID,
+			EventType:  eventType,
+			Payload:    string(payload),
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	created, err := model.Webhooks.CreateDeliveries(deliveries)
+	if err != nil {
+		return err
+	}
+	if len(created) == 0 {
+		return nil
+	}
+	logger.Info("webhook_event_enqueued", zap.String("event_id", event.ID), zap.String("event_type", string(eventType)), zap.Int("deliveries", len(created)))
+
+	cfg := webhookConfig
+	for _, d := range created {
+		go deliverWebhook(context.Background(), logger, cfg, d)
+	}
+	return nil
+}
+
+// deliverWebhook 领取并发送一次投递。领取时先把下次重试时间推迟，进程在发送途中退出也会被重新投递。
+func deliverWebhook(ctx context.Context, logger *zap.Logger, cfg WebhookConfig, delivery *model.WebhookDelivery) {
+	claimed, err := model.Webhooks.ClaimDelivery(delivery.ID, delivery.Attempts, time.Now().Add(cfg.backoff(delivery.Attempts)))
+	if err != nil {
+		logger.Error("webhook_claim_failed", zap.String("delivery_id", delivery.ID), zap.String("error", err.Error()))
+		return
+	}
+	if !claimed {
+		return
+	}
+	delivery.Attempts++
+	logger = logger.With(zap.String("delivery_id", delivery.ID), zap.String("event_id", delivery.EventID), zap.String("endpoint_id", delivery.EndpointID))
+
+	attempt := &model.WebhookDeliveryAttempt{DeliveryID: delivery.ID, Attempt: delivery.Attempts}
+	endpoint, exists := model.Webhooks.GetEndpoint(delivery.EndpointID)
+	switch {
+	case !exists:
+		attempt.Error = "endpoint not found"
+	case !endpoint.Enabled:
+		attempt.Error = "endpoint disabled"
+	default:
+		start := time.Now()
+		attempt.StatusCode, attempt.ResponseBody, err = sendWebhook(ctx, endpoint, delivery)
+		attempt.DurationMs = time.Since(start).Milliseconds()
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+	}
+
+	delivery.LastStatusCode = attempt.StatusCode
+	delivery.LastError = attempt.Error
+	switch {
+	case attempt.Error == "":
+		now := time.Now()
+		delivery.Status = model.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= cfg.MaxAttempts || !exists:
+		delivery.Status = model.WebhookDeliveryFailed
+	default:
+		delivery.Status = model.WebhookDeliveryPending
+		delivery.NextAttemptAt = time.Now().Add(cfg.backoff(delivery.Attempts - 1))
+	}
+
+	if err := model.Webhooks.FinishAttempt(delivery, attempt); err != nil {
+		logger.Error("webhook_attempt_save_failed", zap.String("error", err.Error()))
+		return
+	}
+	if attempt.Error != "" {
+		logger.Warn("webhook_delivery_failed", zap.Int("attempt", attempt.Attempt), zap.Int("status_code", attempt.StatusCode), zap.String("status", string(delivery.Status)), zap.String("error", attempt.Error))
+		return
+	}
+	logger.Info("webhook_delivery_ok", zap.Int("attempt", attempt.Attempt), zap.Int("status_code", attempt.StatusCode), zap.Int64("duration_ms", attempt.DurationMs))
+}
+
+// sendWebhook 以 POST 发送事件，2xx 视为成功。签名为 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制。
+func sendWebhook(ctx context.Context, endpoint *model.WebhookEndpoint, delivery *model.WebhookDelivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookHeaderID, delivery.EventID)
+	req.Header.Set(webhookHeaderEvent, string(delivery.EventType))
+	req.Header.Set(webhookHeaderTimestamp, timestamp)
+	req.Header.Set(webhookHeaderSignature, "v1="+signWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseLog))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
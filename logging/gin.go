@@ -54,6 +54,12 @@ func TraceIDFromContext(ctx context.Context) string {
 	return ""
 }
 
+// WithNewTraceID 为后台任务生成 trace_id 并放入 ctx，使任务日志和状态历史可以像接口请求一样串联。
+func WithNewTraceID(ctx context.Context) (context.Context, string) {
+	traceID := newTraceID()
+	return context.WithValue(ctx, keyTraceID, traceID), traceID
+}
+
 func Middleware(base *zap.Logger, cfg config.TraceConfig) gin.HandlerFunc {
 	if base == nil {
 		base = L()
@@ -56,6 +56,15 @@ func L() *zap.Logger {
 	return logger
 }
 
+// WithJobLock 在日志中附带后台任务锁的名称、持有者和 fencing token，
+// 多实例部署时可以据此判断某条任务日志来自哪一次持锁。
+func WithJobLock(l *zap.Logger, name, owner string, token int64) *zap.Logger {
+	if l == nil {
+		l = L()
+	}
+	return l.With(zap.String("job_lock", name), zap.String("lock_owner", owner), zap.Int64("lock_token", token))
+}
+
 func buildWriteSyncer(cfg config.LogConfig) (zapcore.WriteSyncer, error) {
 	var syncers []zapcore.WriteSyncer
 
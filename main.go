@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"pay/config"
 	"pay/ealipay"
 	"pay/handler"
 	"pay/logging"
 	"pay/model"
+	"slices"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -47,18 +51,46 @@ func main() {
 	}
 
 	alipayCfg := &ealipay.Config{
-		AppId:           sandbox.AppId,
-		PrivateKey:      sandbox.PrivateKey,
-		AlipayPublicKey: sandbox.AlipayPublicKey,
-		IsSandbox:       true,
-		NotifyURL:       sandbox.NotifyURL,
-		ReturnURL:       sandbox.ReturnURL,
+		AppId:            sandbox.AppId,
+		SellerId:         sandbox.SellerId,
+		PrivateKey:       sandbox.PrivateKey,
+		AlipayPublicKey:  sandbox.AlipayPublicKey,
+		IsSandbox:        true,
+		NotifyURL:        sandbox.NotifyURL,
+		ReturnURL:        sandbox.ReturnURL,
+		AppPublicCert:    sandbox.AppPublicCert,
+		AlipayPublicCert: sandbox.AlipayPublicCert,
+		AlipayRootCert:   sandbox.AlipayRootCert,
 	}
 
 	if err := handler.InitAlipayClient(alipayCfg); err != nil {
 		logger.Fatal("alipay_client_init_failed", zap.Error(err))
 	}
 
+	if appCfg.Reconciler.Enabled {
+		handler.StartReconciler(context.Background(), reconcilerConfig(appCfg.Reconciler))
+	}
+	if err := checkWebhookOutbox(appCfg); err != nil {
+		logger.Fatal("webhook_config_invalid", zap.Error(err))
+	}
+	if appCfg.Outbox.Enabled {
+		outboxCfg, err := outboxConfig(appCfg.Outbox, logger)
+		if err != nil {
+			logger.Fatal("outbox_config_invalid", zap.Error(err))
+		}
+		handler.StartOutboxRelay(context.Background(), outboxCfg)
+	}
+	if appCfg.Webhook.Enabled {
+		handler.StartWebhookDispatcher(context.Background(), webhookConfig(appCfg.Webhook))
+	}
+	if appCfg.BillReconciler.Enabled {
+		handler.StartBillReconciler(context.Background(), handler.BillReconcilerConfig{
+			Hour:          appCfg.BillReconciler.Hour,
+			RetryInterval: time.Duration(appCfg.BillReconciler.RetryIntervalMinutes) * time.Minute,
+			MaxRetries:    appCfg.BillReconciler.MaxRetries,
+		})
+	}
+
 	r := gin.New()
 	r.Use(logging.Middleware(logger, appCfg.Trace))
 	r.Use(gin.Recovery())
@@ -72,12 +104,28 @@ func main() {
 
 	api := r.Group("/api")
 	{
-		api.POST("/orders", handler.CreateOrder)
-		api.POST("/app-orders", handler.CreateAppOrder)
+		api.POST("/orders", handler.Idempotent(), handler.CreateOrder)
+		api.POST("/app-orders", handler.Idempotent(), handler.CreateAppOrder)
+		api.POST("/wap-orders", handler.CreateWapOrder)
+		api.POST("/pos-orders", handler.CreatePosOrder)
 		api.GET("/orders", handler.ListOrders)
 		api.GET("/orders/:id", handler.GetOrder)
 		api.PUT("/orders/:id/status", handler.UpdateOrderStatus) // 调试用的订单状态更新接口
+		api.GET("/orders/:id/status-history", handler.ListOrderStatusHistory)
+		api.GET("/orders/:id/events", handler.ListOrderEvents)
 		api.POST("/orders/:id/sync", handler.SyncOrderStatus)
+		api.POST("/orders/:id/cancel", handler.CancelOrder)
+		api.GET("/orders/:id/refunds", handler.ListRefunds)
+		api.POST("/orders/:id/refunds", handler.CreateRefund)
+		api.POST("/orders/:id/refunds/:refund_id/sync", handler.SyncRefundStatus)
+		api.POST("/webhooks", handler.CreateWebhookEndpoint)
+		api.GET("/webhooks", handler.ListWebhookEndpoints)
+		api.PUT("/webhooks/:id", handler.UpdateWebhookEndpoint)
+		api.GET("/webhooks/:id/deliveries", handler.ListWebhookDeliveries)
+		api.GET("/webhook-deliveries/:id", handler.GetWebhookDelivery)
+		api.POST("/webhook-deliveries/:id/redeliver", handler.RedeliverWebhook)
+		api.POST("/reconciliations/:date", handler.ReconcileBill)
+		api.GET("/reconciliations/:date/diffs", handler.ListReconciliationDiffs)
 		api.POST("/alipay/notify", handler.AlipayNotify)
 		api.POST("/alipay/sandbox/notify", handler.AlipayNotify)
 	}
@@ -87,3 +135,59 @@ func main() {
 		logger.Fatal("server_run_failed", zap.Error(err))
 	}
 }
+
+func reconcilerConfig(cfg config.ReconcilerConfig) handler.ReconcilerConfig {
+	out := handler.ReconcilerConfig{
+		Interval:    time.Duration(cfg.IntervalSeconds) * time.Second,
+		Concurrency: cfg.Concurrency,
+		BatchSize:   cfg.BatchSize,
+	}
+	for _, s := range cfg.BackoffSeconds {
+		out.Backoff = append(out.Backoff, time.Duration(s)*time.Second)
+	}
+	return out
+}
+
+func webhookConfig(cfg config.WebhookConfig) handler.WebhookConfig {
+	return handler.WebhookConfig{
+		Interval:    time.Duration(cfg.IntervalSeconds) * time.Second,
+		Concurrency: cfg.Concurrency,
+		BatchSize:   cfg.BatchSize,
+		MaxAttempts: cfg.MaxAttempts,
+		Timeout:     time.Duration(cfg.TimeoutSeconds) * time.Second,
+		Backoff:     time.Duration(cfg.BackoffSeconds) * time.Second,
+	}
+}
+
+func outboxConfig(cfg config.OutboxConfig, logger *zap.Logger) (handler.OutboxConfig, error) {
+	out := handler.OutboxConfig{
+		Interval:  time.Duration(cfg.IntervalSeconds) * time.Second,
+		BatchSize: cfg.BatchSize,
+		Backoff:   time.Duration(cfg.BackoffSeconds) * time.Second,
+	}
+	for _, name := range cfg.Sinks {
+		switch name {
+		case "webhook":
+			out.Sinks = append(out.Sinks, handler.WebhookSink{Logger: logger})
+		case "log":
+			out.Sinks = append(out.Sinks, handler.LogSink{Logger: logger})
+		case "broker":
+			out.Sinks = append(out.Sinks, handler.BrokerSink{Broker: handler.NewLocalBroker(), Topic: cfg.BrokerTopic})
+		default:
+			return out, fmt.Errorf("unknown outbox sink %q", name)
+		}
+	}
+	return out, nil
+}
+
+// checkWebhookOutbox 确认商户回调有事件来源：订单和退款事件只经 outbox 的 webhook sink 转成回调，
+// 开启 webhook 却没有配置该 sink 时不会有任何回调发出。
+func checkWebhookOutbox(cfg config.AppConfig) error {
+	if !cfg.Webhook.Enabled {
+		return nil
+	}
+	if !cfg.Outbox.Enabled || !slices.Contains(cfg.Outbox.Sinks, "webhook") {
+		return fmt.Errorf("webhook.enabled requires outbox.enabled with \"webhook\" in outbox.sinks")
+	}
+	return nil
+}
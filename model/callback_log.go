@@ -2,6 +2,12 @@ package model
 
 import "time"
 
+// VerifyError 中的错误类别前缀
+const (
+	CallbackVerifyOrderNotFound = "order not found"
+	CallbackVerifyTradeMismatch = "trade mismatch"
+)
+
 type CallbackLog struct {
 	ID          uint64    `gorm:"primaryKey;autoIncrement"`
 	Provider    string    `gorm:"type:varchar(32);index"`
@@ -16,6 +22,7 @@ type CallbackLog struct {
 	NotifyID    string    `gorm:"type:varchar(128);index"`
 	Sign        string    `gorm:"type:text"`
 	VerifyOK    bool      `gorm:"index"`
+	Duplicate   bool      `gorm:"index"` // notify_id 已处理过的重复投递
 	VerifyError string    `gorm:"type:text"`
 	ParamsJSON  string    `gorm:"type:longtext"`
 	HeadersJSON string    `gorm:"type:longtext"`
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// IdempotencyRecord 保存带 Idempotency-Key 的请求第一次的应答，重复请求直接回放。
+type IdempotencyRecord struct {
+	ID           uint64    `gorm:"primaryKey;autoIncrement"`
+	Scope        string    `gorm:"type:varchar(128);uniqueIndex:uk_idempotency_scope_key"`
+	Key          string    `gorm:"column:idempotency_key;type:varchar(128);uniqueIndex:uk_idempotency_scope_key"`
+	RequestHash  string    `gorm:"type:varchar(64)"`
+	Completed    bool      `gorm:"not null;default:false"`
+	StatusCode   int       `gorm:"not null;default:0"`
+	ResponseBody string    `gorm:"type:longtext"`
+	CreatedAt    time.Time `gorm:"index"`
+	UpdatedAt    time.Time
+}
+
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_key"
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyStore interface {
+	// Reserve 为 scope + key 占位。已有记录时返回它且 reserved 为 false；
+	// 未完成且早于 staleBefore 的记录视为上次处理中途崩溃，重新占位。
+	Reserve(rec *IdempotencyRecord, staleBefore time.Time) (existing *IdempotencyRecord, reserved bool, err error)
+	Complete(scope, key string, statusCode int, body string) error
+	// Release 删除未完成的占位，让客户端可以用同一个 key 重试。
+	Release(scope, key string) error
+}
+
+type InMemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+}
+
+var Idempotency IdempotencyStore = &InMemoryIdempotencyStore{records: make(map[string]*IdempotencyRecord)}
+
+func idempotencyMapKey(scope, key string) string {
+	return scope + "\x00" + key
+}
+
+func (s *InMemoryIdempotencyStore) Reserve(rec *IdempotencyRecord, staleBefore time.Time) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyMapKey(rec.Scope, rec.Key)
+	if existing, ok := s.records[k]; ok && (existing.Completed || !existing.CreatedAt.Before(staleBefore)) {
+		copied := *existing
+		return &copied, false, nil
+	}
+	now := time.Now()
+	rec.CreatedAt = now
+	rec.UpdatedAt = now
+	copied := *rec
+	s.records[k] = &copied
+	return nil, true, nil
+}
+
+func (s *InMemoryIdempotencyStore) Complete(scope, key string, statusCode int, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[idempotencyMapKey(scope, key)]
+	if !ok {
+		return errors.New("idempotency record not found")
+	}
+	rec.Completed = true
+	rec.StatusCode = statusCode
+	rec.ResponseBody = body
+	rec.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *InMemoryIdempotencyStore) Release(scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyMapKey(scope, key)
+	if rec, ok := s.records[k]; ok && !rec.Completed {
+		delete(s.records, k)
+	}
+	return nil
+}
+
+type GormIdempotencyStore struct {
+	db *gorm.DB
+}
+
+func InitGormIdempotencyStore(db *gorm.DB) error {
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	if err := db.AutoMigrate(&IdempotencyRecord{}); err != nil {
+		return err
+	}
+	Idempotency = &GormIdempotencyStore{db: db}
+	return nil
+}
+
+func (s *GormIdempotencyStore) Reserve(rec *IdempotencyRecord, staleBefore time.Time) (*IdempotencyRecord, bool, error) {
+	now := time.Now()
+	rec.CreatedAt = now
+	rec.UpdatedAt = now
+	res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(rec)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil, true, nil
+	}
+
+	res = s.db.Model(&IdempotencyRecord{}).
+		Where("scope = ? AND idempotency_key = ? AND completed = ? AND created_at < ?", rec.Scope, rec.Key, false, staleBefore).
+		Updates(map[string]any{"request_hash": rec.RequestHash, "created_at": now, "updated_at": now})
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil, true, nil
+	}
+
+	var existing IdempotencyRecord
+	if err := s.db.First(&existing, "scope = ? AND idempotency_key = ?", rec.Scope, rec.Key).Error; err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+func (s *GormIdempotencyStore) Complete(scope, key string, statusCode int, body string) error {
+	return s.db.Model(&IdempotencyRecord{}).
+		Where("scope = ? AND idempotency_key = ?", scope, key).
+		Updates(map[string]any{"completed": true, "status_code": statusCode, "response_body": body, "updated_at": time.Now()}).Error
+}
+
+func (s *GormIdempotencyStore) Release(scope, key string) error {
+	return s.db.Where("scope = ? AND idempotency_key = ? AND completed = ?", scope, key, false).Delete(&IdempotencyRecord{}).Error
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	ErrLockHeld = errors.New("job lock is held by another owner")
+	ErrLockLost = errors.New("job lock lost")
+)
+
+// JobLock 是后台任务的租约。每次被重新获取时 Token 递增，作为 fencing token：
+// 持有旧 token 的实例即使还在运行，续约和释放也会失败。
+type JobLock struct {
+	Name      string    `json:"name" gorm:"primaryKey;type:varchar(64)"`
+	Owner     string    `json:"owner" gorm:"type:varchar(128)"`
+	Token     int64     `json:"token" gorm:"not null;default:0"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (JobLock) TableName() string {
+	return "job_lock"
+}
+
+// NewLockOwner 生成当前进程的锁持有者标识：主机名、进程号加随机后缀。
+func NewLockOwner() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(b))
+}
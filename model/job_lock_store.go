@@ -0,0 +1,165 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type JobLockStore interface {
+	// Acquire 在锁不存在、已释放或已过期时获取锁并递增 token，否则返回 ErrLockHeld。
+	// 同一 owner 也不能重入，避免同一进程里同一任务的两次运行互相顶掉租约。
+	Acquire(name, owner string, ttl time.Duration) (*JobLock, error)
+	// Renew 把租约延长 ttl。锁已被他人获取（owner 或 token 变化）时返回 ErrLockLost。
+	Renew(lock *JobLock, ttl time.Duration) error
+	Release(lock *JobLock) error
+}
+
+type InMemoryJobLockStore struct {
+	mu    sync.Mutex
+	locks map[string]*JobLock
+}
+
+var JobLocks JobLockStore = &InMemoryJobLockStore{locks: make(map[string]*JobLock)}
+
+func (s *InMemoryJobLockStore) Acquire(name, owner string, ttl time.Duration) (*JobLock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	lock, exists := s.locks[name]
+	if !exists {
+		lock = &JobLock{Name: name}
+		s.locks[name] = lock
+	} else if lock.ExpiresAt.After(now) {
+		return nil, ErrLockHeld
+	}
+	lock.Owner = owner
+	lock.Token++
+	lock.ExpiresAt = now.Add(ttl)
+	lock.UpdatedAt = now
+	copied := *lock
+	return &copied, nil
+}
+
+func (s *InMemoryJobLockStore) Renew(lock *JobLock, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.locks[lock.Name]
+	if !exists || current.Owner != lock.Owner || current.Token != lock.Token {
+		return ErrLockLost
+	}
+	now := time.Now()
+	current.ExpiresAt = now.Add(ttl)
+	current.UpdatedAt = now
+	lock.ExpiresAt = current.ExpiresAt
+	return nil
+}
+
+func (s *InMemoryJobLockStore) Release(lock *JobLock) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.locks[lock.Name]
+	if !exists || current.Owner != lock.Owner || current.Token != lock.Token {
+		return ErrLockLost
+	}
+	current.Owner = ""
+	current.ExpiresAt = time.Now()
+	return nil
+}
+
+// GormJobLockStore 用数据库时间判断过期，不依赖各实例的本地时钟一致。
+type GormJobLockStore struct {
+	db *gorm.DB
+}
+
+func InitGormJobLockStore(db *gorm.DB) error {
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	if err := db.AutoMigrate(&JobLock{}); err != nil {
+		return err
+	}
+	JobLocks = &GormJobLockStore{db: db}
+	return nil
+}
+
+func leaseUntil(ttl time.Duration) clause.Expr {
+	return gorm.Expr("DATE_ADD(NOW(3), INTERVAL ? MICROSECOND)", ttl.Microseconds())
+}
+
+func (s *GormJobLockStore) Acquire(name, owner string, ttl time.Duration) (*JobLock, error) {
+	res := s.db.Model(&JobLock{}).Clauses(clause.OnConflict{DoNothing: true}).Create(map[string]any{
+		"name":       name,
+		"owner":      owner,
+		"token":      1,
+		"expires_at": leaseUntil(ttl),
+		"updated_at": gorm.Expr("NOW(3)"),
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		res = s.db.Model(&JobLock{}).
+			Where("name = ? AND expires_at <= NOW(3)", name).
+			Updates(map[string]any{
+				"owner":      owner,
+				"token":      gorm.Expr("token + 1"),
+				"expires_at": leaseUntil(ttl),
+				"updated_at": gorm.Expr("NOW(3)"),
+			})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, ErrLockHeld
+		}
+	}
+
+	var lock JobLock
+	if err := s.db.First(&lock, "name = ?", name).Error; err != nil {
+		return nil, err
+	}
+	if lock.Owner != owner {
+		return nil, ErrLockHeld
+	}
+	return &lock, nil
+}
+
+func (s *GormJobLockStore) Renew(lock *JobLock, ttl time.Duration) error {
+	res := s.db.Model(&JobLock{}).
+		Where("name = ? AND owner = ? AND token = ?", lock.Name, lock.Owner, lock.Token).
+		Updates(map[string]any{
+			"expires_at": leaseUntil(ttl),
+			"updated_at": gorm.Expr("NOW(3)"),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (s *GormJobLockStore) Release(lock *JobLock) error {
+	res := s.db.Model(&JobLock{}).
+		Where("name = ? AND owner = ? AND token = ?", lock.Name, lock.Owner, lock.Token).
+		Updates(map[string]any{
+			"owner":      "",
+			"expires_at": gorm.Expr("NOW(3)"),
+			"updated_at": gorm.Expr("NOW(3)"),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
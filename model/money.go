@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"pay/ealipay"
+)
+
+type Currency string
+
+const CurrencyCNY Currency = "CNY"
+
+// Money 是以分为单位的订单金额，与 ealipay.Amount 同一表示，可以直接互相转换；
+// 在其基础上增加了下单时的严格校验。支付宝单笔金额范围是 0.01 到 100000000.00 元。
+type Money ealipay.Amount
+
+const (
+	MinMoney Money = 1
+	MaxMoney Money = 100_000_000_00
+)
+
+var (
+	ErrInvalidMoney    = errors.New("invalid money amount")
+	ErrMoneyOutOfRange = errors.New("money amount out of range")
+)
+
+// ParseMoney 严格解析元为单位的金额字符串：只允许非负十进制数，最多两位小数，且在 MinMoney 到 MaxMoney 之间。
+// 数值转换交给 ealipay.ParseAmount，这里只补充它没有拒绝的写法（前导零、空白、"1."）。
+func ParseMoney(s string) (Money, error) {
+	intPart, fracPart, hasDot := strings.Cut(s, ".")
+	if intPart == "" || len(fracPart) > 2 || (hasDot && fracPart == "") || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	if len(intPart) > 1 && intPart[0] == '0' {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	a, err := ealipay.ParseAmount(s)
+	if err != nil {
+		// 语法已经校验过，ParseAmount 失败只可能是数值溢出
+		return 0, fmt.Errorf("%w: %q", ErrMoneyOutOfRange, s)
+	}
+	m := Money(a)
+	if err := m.Validate(); err != nil {
+		return 0, fmt.Errorf("%w: %q", err, s)
+	}
+	return m, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) Validate() error {
+	if m < MinMoney || m > MaxMoney {
+		return ErrMoneyOutOfRange
+	}
+	return nil
+}
+
+// String 按支付宝 total_amount 的格式输出两位小数的元。
+func (m Money) String() string {
+	return ealipay.Amount(m).String()
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*m = 0
+		return nil
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
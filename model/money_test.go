@@ -0,0 +1,65 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"pay/ealipay"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr error
+	}{
+		{"0.01", 1, nil},
+		{"1", 100, nil},
+		{"1.5", 150, nil},
+		{"12.34", 1234, nil},
+		{"100000000", MaxMoney, nil},
+		{"100000000.00", MaxMoney, nil},
+		{"abc", 0, ErrInvalidMoney},
+		{"", 0, ErrInvalidMoney},
+		{"-1", 0, ErrInvalidMoney},
+		{"+1", 0, ErrInvalidMoney},
+		{"0.001", 0, ErrInvalidMoney},
+		{"1.", 0, ErrInvalidMoney},
+		{".5", 0, ErrInvalidMoney},
+		{"01.00", 0, ErrInvalidMoney},
+		{" 1.00", 0, ErrInvalidMoney},
+		{"1e3", 0, ErrInvalidMoney},
+		{"0", 0, ErrMoneyOutOfRange},
+		{"0.00", 0, ErrMoneyOutOfRange},
+		{"100000000.01", 0, ErrMoneyOutOfRange},
+		{"99999999999999999999", 0, ErrMoneyOutOfRange},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseMoney(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMoneyMatchesAmount(t *testing.T) {
+	for _, s := range []string{"0.01", "0.10", "12.34", "100000000.00"} {
+		m, err := ParseMoney(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := ealipay.ParseAmount(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ealipay.Amount(m) != a || m.String() != a.String() || m.String() != s {
+			t.Errorf("%q: money %s (%d), amount %s (%d)", s, m, m, a, a)
+		}
+	}
+}
@@ -5,21 +5,53 @@ import "time"
 type OrderStatus string
 
 const (
-	OrderStatusPending OrderStatus = "pending"
-	OrderStatusPaid    OrderStatus = "paid"
-	OrderStatusFailed  OrderStatus = "failed"
-	OrderStatusClosed  OrderStatus = "closed"
+	OrderStatusPending           OrderStatus = "pending"
+	OrderStatusPaid              OrderStatus = "paid"
+	OrderStatusFailed            OrderStatus = "failed"
+	OrderStatusClosed            OrderStatus = "closed"
+	OrderStatusPartiallyRefunded OrderStatus = "partially_refunded"
+	OrderStatusRefunded          OrderStatus = "refunded"
+)
+
+// DefaultOrderTimeout 决定订单的 ExpiresAt，下单时作为绝对的 time_expire 传给支付宝，超时未支付的订单由后台任务关闭。
+const DefaultOrderTimeout = 30 * time.Minute
+
+// OrderExpireGrace 是超过 ExpiresAt 之后额外等待的时间，覆盖与支付宝之间的时钟偏差和超时前一刻发起的支付。
+// 在此之前支付宝侧查不到交易也不能只关闭本地订单：买家随时可能打开支付链接完成付款。
+const OrderExpireGrace = 5 * time.Minute
+
+type PayType string
+
+const (
+	PayTypePage      PayType = "page"
+	PayTypePrecreate PayType = "precreate"
+	PayTypeBarcode   PayType = "barcode"
+	PayTypeWap       PayType = "wap"
+	PayTypeApp       PayType = "app"
 )
 
 type Order struct {
-	ID          string      `json:"id" gorm:"primaryKey;type:varchar(64)"`
-	OutTradeNo  string      `json:"out_trade_no" gorm:"uniqueIndex;type:varchar(64)"`
-	TotalAmount string      `json:"total_amount" gorm:"type:varchar(32)"`
-	Subject     string      `json:"subject" gorm:"type:varchar(255)"`
-	Body        string      `json:"body" gorm:"type:text"`
-	QrCode      string      `json:"qr_code" gorm:"type:longtext"`
-	Status      OrderStatus `json:"status" gorm:"type:varchar(16);index"`
-	TradeNo     string      `json:"trade_no,omitempty" gorm:"type:varchar(64)"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
+	ID                string      `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	OutTradeNo        string      `json:"out_trade_no" gorm:"uniqueIndex;type:varchar(64)"`
+	MerchantOrderNo   string      `json:"merchant_order_no,omitempty" gorm:"type:varchar(128);index"`
+	TotalAmount       Money       `json:"total_amount" gorm:"column:total_amount_fen;not null;default:0"`
+	Currency          Currency    `json:"currency" gorm:"type:varchar(3);not null;default:CNY"`
+	Subject           string      `json:"subject" gorm:"type:varchar(255)"`
+	Body              string      `json:"body" gorm:"type:text"`
+	QrCode            string      `json:"qr_code" gorm:"type:longtext"`
+	PayType           PayType     `json:"pay_type" gorm:"type:varchar(16)"`
+	Status            OrderStatus `json:"status" gorm:"type:varchar(32);index"`
+	TradeNo           string      `json:"trade_no,omitempty" gorm:"type:varchar(64)"`
+	GmtPayment        *time.Time  `json:"gmt_payment,omitempty" gorm:"index"`
+	Version           int64       `json:"version" gorm:"not null;default:0"`
+	ExpiresAt         time.Time   `json:"expires_at"`
+	ReconcileAttempts int         `json:"-" gorm:"not null;default:0"`
+	NextReconcileAt   time.Time   `json:"-" gorm:"index"`
+	CreatedAt         time.Time   `json:"created_at"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+}
+
+// PayWindowClosed 表示订单已超过 ExpiresAt 和 OrderExpireGrace，支付宝不会再为它创建或完成交易。
+func (o *Order) PayWindowClosed(now time.Time) bool {
+	return now.After(o.ExpiresAt.Add(OrderExpireGrace))
 }
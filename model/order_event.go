@@ -0,0 +1,139 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type OrderEventStatus string
+
+const (
+	OrderEventPending OrderEventStatus = "pending"
+	OrderEventSent    OrderEventStatus = "sent"
+)
+
+// OrderEvent 是订单状态变更和退款成功的 outbox 记录，与对应的更新在同一事务中写入，由后台 relay 发布后标记为 sent。
+// 退款事件的 FromStatus / ToStatus 为空，payload 是 RefundEventPayload。
+type OrderEvent struct {
+	ID            uint64           `json:"id" gorm:"primaryKey;autoIncrement"`
+	EventID       string           `json:"event_id" gorm:"type:varchar(64);uniqueIndex"`
+	OrderID       string           `json:"order_id" gorm:"type:varchar(64);index"`
+	EventType     string           `json:"event_type" gorm:"type:varchar(64)"`
+	FromStatus    OrderStatus      `json:"from_status" gorm:"type:varchar(32)"`
+	ToStatus      OrderStatus      `json:"to_status" gorm:"type:varchar(32)"`
+	Payload       string           `json:"payload" gorm:"type:text"`
+	Status        OrderEventStatus `json:"status" gorm:"type:varchar(16);index:idx_order_event_pending,priority:1"`
+	Attempts      int              `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time        `json:"next_attempt_at" gorm:"index:idx_order_event_pending,priority:2"`
+	LastError     string           `json:"last_error,omitempty" gorm:"type:text"`
+	SentAt        *time.Time       `json:"sent_at,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+func (OrderEvent) TableName() string {
+	return "order_event"
+}
+
+// OrderEventPayload 是事件发生时的订单快照。同一订单的事件可能乱序到达，消费方应以 Version 较大者为准。
+type OrderEventPayload struct {
+	EventID         string           `json:"event_id"`
+	EventType       string           `json:"event_type"`
+	OrderID         string           `json:"order_id"`
+	OutTradeNo      string           `json:"out_trade_no"`
+	MerchantOrderNo string           `json:"merchant_order_no,omitempty"`
+	TradeNo         string           `json:"trade_no,omitempty"`
+	FromStatus      OrderStatus      `json:"from_status"`
+	Status          OrderStatus      `json:"status"`
+	Version         int64            `json:"version"`
+	TotalAmount     Money            `json:"total_amount"`
+	Currency        Currency         `json:"currency"`
+	Subject         string           `json:"subject"`
+	PayType         PayType          `json:"pay_type"`
+	Source          TransitionSource `json:"source"`
+	TraceID         string           `json:"trace_id,omitempty"`
+	Reason          string           `json:"reason,omitempty"`
+	OccurredAt      time.Time        `json:"occurred_at"`
+}
+
+// OrderEventType 返回状态变为 to 时的事件类型，如 order.paid。
+func OrderEventType(to OrderStatus) string {
+	return "order." + string(to)
+}
+
+// newOrderEvent 由已经更新后的订单生成 outbox 记录。
+func newOrderEvent(order *Order, from OrderStatus, change StatusChange, at time.Time) *OrderEvent {
+	eventID := NewEventID()
+	eventType := OrderEventType(order.Status)
+	payload, _ := json.Marshal(OrderEventPayload{
+		EventID:         eventID,
+		EventType:       eventType,
+		OrderID:         order.ID,
+		OutTradeNo:      order.OutTradeNo,
+		MerchantOrderNo: order.MerchantOrderNo,
+		TradeNo:         order.TradeNo,
+		FromStatus:      from,
+		Status:          order.Status,
+		Version:         order.Version,
+		TotalAmount:     order.TotalAmount,
+		Currency:        order.Currency,
+		Subject:         order.Subject,
+		PayType:         order.PayType,
+		Source:          change.Source,
+		TraceID:         change.TraceID,
+		Reason:          change.Reason,
+		OccurredAt:      at,
+	})
+	return &OrderEvent{
+		EventID:       eventID,
+		OrderID:       order.ID,
+		EventType:     eventType,
+		FromStatus:    from,
+		ToStatus:      order.Status,
+		Payload:       string(payload),
+		Status:        OrderEventPending,
+		NextAttemptAt: at,
+		CreatedAt:     at,
+	}
+}
+
+// RefundEventSucceeded 是退款首次成功时写入 outbox 的事件类型。
+const RefundEventSucceeded = "refund.succeeded"
+
+// RefundEventPayload 是退款成功时的退款快照。
+type RefundEventPayload struct {
+	EventID      string       `json:"event_id"`
+	EventType    string       `json:"event_type"`
+	RefundID     string       `json:"refund_id"`
+	OrderID      string       `json:"order_id"`
+	OutTradeNo   string       `json:"out_trade_no"`
+	TradeNo      string       `json:"trade_no,omitempty"`
+	OutRequestNo string       `json:"out_request_no"`
+	RefundAmount Money        `json:"refund_amount"`
+	Status       RefundStatus `json:"status"`
+	OccurredAt   time.Time    `json:"occurred_at"`
+}
+
+func newRefundEvent(refund *Refund, at time.Time) *OrderEvent {
+	eventID := NewEventID()
+	payload, _ := json.Marshal(RefundEventPayload{
+		EventID:      eventID,
+		EventType:    RefundEventSucceeded,
+		RefundID:     refund.ID,
+		OrderID:      refund.OrderID,
+		OutTradeNo:   refund.OutTradeNo,
+		TradeNo:      refund.TradeNo,
+		OutRequestNo: refund.OutRequestNo,
+		RefundAmount: refund.RefundAmount,
+		Status:       refund.Status,
+		OccurredAt:   at,
+	})
+	return &OrderEvent{
+		EventID:       eventID,
+		OrderID:       refund.OrderID,
+		EventType:     RefundEventSucceeded,
+		Payload:       string(payload),
+		Status:        OrderEventPending,
+		NextAttemptAt: at,
+		CreatedAt:     at,
+	}
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OrderEventStore 读取和更新 outbox。事件本身只由 OrderStore 和 RefundStore 在各自更新的同一事务中写入。
+type OrderEventStore interface {
+	// ListPending 返回已到期的待发布事件，按写入顺序排列。
+	ListPending(now time.Time, limit int) []*OrderEvent
+	MarkSent(id uint64) error
+	// MarkFailed 记录一次发布失败，把下次发布推迟到 next。
+	MarkFailed(id uint64, lastError string, next time.Time) error
+	ListByOrderID(orderID string) []*OrderEvent
+}
+
+type InMemoryOrderEventStore struct {
+	mu     sync.RWMutex
+	events []*OrderEvent
+	seq    uint64
+}
+
+var memOrderEvents = &InMemoryOrderEventStore{}
+
+var OrderEvents OrderEventStore = memOrderEvents
+
+func (s *InMemoryOrderEventStore) add(event *OrderEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	event.ID = s.seq
+	s.events = append(s.events, event)
+}
+
+func (s *InMemoryOrderEventStore) ListPending(now time.Time, limit int) []*OrderEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]*OrderEvent, 0)
+	for _, e := range s.events {
+		if e.Status == OrderEventPending && !e.NextAttemptAt.After(now) {
+			copied := *e
+			events = append(events, &copied)
+			if limit > 0 && len(events) == limit {
+				break
+			}
+		}
+	}
+	return events
+}
+
+func (s *InMemoryOrderEventStore) MarkSent(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.events {
+		if e.ID == id {
+			now := time.Now()
+			e.Status = OrderEventSent
+			e.Attempts++
+			e.LastError = ""
+			e.SentAt = &now
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryOrderEventStore) MarkFailed(id uint64, lastError string, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.events {
+		if e.ID == id {
+			e.Attempts++
+			e.LastError = lastError
+			e.NextAttemptAt = next
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryOrderEventStore) ListByOrderID(orderID string) []*OrderEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]*OrderEvent, 0)
+	for _, e := range s.events {
+		if e.OrderID == orderID {
+			copied := *e
+			events = append(events, &copied)
+		}
+	}
+	return events
+}
+
+type GormOrderEventStore struct {
+	db *gorm.DB
+}
+
+func (s *GormOrderEventStore) ListPending(now time.Time, limit int) []*OrderEvent {
+	var events []*OrderEvent
+	_ = s.db.Where("status = ? AND next_attempt_at <= ?", OrderEventPending, now).
+		Order("id asc").Limit(limit).Find(&events).Error
+	return events
+}
+
+func (s *GormOrderEventStore) MarkSent(id uint64) error {
+	return s.db.Model(&OrderEvent{}).Where("id = ?", id).Updates(map[string]any{
+		"status":     OrderEventSent,
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": "",
+		"sent_at":    time.Now(),
+	}).Error
+}
+
+func (s *GormOrderEventStore) MarkFailed(id uint64, lastError string, next time.Time) error {
+	return s.db.Model(&OrderEvent{}).Where("id = ?", id).Updates(map[string]any{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      lastError,
+		"next_attempt_at": next,
+	}).Error
+}
+
+func (s *GormOrderEventStore) ListByOrderID(orderID string) []*OrderEvent {
+	var events []*OrderEvent
+	_ = s.db.Where("order_id = ?", orderID).Order("id asc").Find(&events).Error
+	return events
+}
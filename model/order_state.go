@@ -0,0 +1,81 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrOrderNotFound     = errors.New("order not found")
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	// ErrConcurrentUpdate 表示条件更新时订单已被其他请求修改，调用方应重新读取后再决定是否重试。
+	ErrConcurrentUpdate = errors.New("order was modified concurrently")
+)
+
+// orderTransitions 列出合法的状态流转，相同状态之间的“流转”视为无操作。
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:           {OrderStatusPaid, OrderStatusClosed, OrderStatusFailed},
+	OrderStatusPaid:              {OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusPartiallyRefunded: {OrderStatusRefunded},
+}
+
+func CanTransition(from, to OrderStatus) bool {
+	if from == to {
+		return true
+	}
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+type TransitionError struct {
+	OrderID string
+	From    OrderStatus
+	To      OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order %s: cannot transition from %s to %s", e.OrderID, e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+func checkTransition(orderID string, from, to OrderStatus) error {
+	if !CanTransition(from, to) {
+		return &TransitionError{OrderID: orderID, From: from, To: to}
+	}
+	return nil
+}
+
+type TransitionSource string
+
+const (
+	TransitionSourceNotify TransitionSource = "notify"
+	TransitionSourceSync   TransitionSource = "sync"
+	TransitionSourceAdmin  TransitionSource = "admin"
+	TransitionSourceJob    TransitionSource = "job"
+	TransitionSourceAPI    TransitionSource = "api"
+)
+
+// StatusChange 描述一次状态变更的来源，会写入 order_status_history。
+type StatusChange struct {
+	Source  TransitionSource
+	TraceID string
+	Reason  string
+	// PaidAt 是支付宝返回的付款时间（gmt_payment / send_pay_date），流转为 paid 时写入订单的 GmtPayment，
+	// 为空时取流转的时间。账单按支付宝的付款时间切日，对账以它为准。
+	PaidAt time.Time
+}
+
+func (c StatusChange) paidAt(now time.Time) time.Time {
+	if c.PaidAt.IsZero() {
+		return now
+	}
+	return c.PaidAt
+}
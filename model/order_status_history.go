@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+type OrderStatusHistory struct {
+	ID         uint64           `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrderID    string           `json:"order_id" gorm:"type:varchar(64);index"`
+	FromStatus OrderStatus      `json:"from_status" gorm:"type:varchar(32)"`
+	ToStatus   OrderStatus      `json:"to_status" gorm:"type:varchar(32)"`
+	Source     TransitionSource `json:"source" gorm:"type:varchar(16);index"`
+	TraceID    string           `json:"trace_id,omitempty" gorm:"type:varchar(64);index"`
+	TradeNo    string           `json:"trade_no,omitempty" gorm:"type:varchar(64)"`
+	Reason     string           `json:"reason,omitempty" gorm:"type:varchar(255)"`
+	CreatedAt  time.Time        `json:"created_at" gorm:"index"`
+}
+
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
+
+func newStatusHistory(orderID string, from, to OrderStatus, tradeNo string, change StatusChange, at time.Time) *OrderStatusHistory {
+	return &OrderStatusHistory{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		Source:     change.Source,
+		TraceID:    change.TraceID,
+		TradeNo:    tradeNo,
+		Reason:     change.Reason,
+		CreatedAt:  at,
+	}
+}
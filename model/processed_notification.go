@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// ProcessedNotification 记录已经处理过的支付宝异步通知，用 notify_id 去重。
+type ProcessedNotification struct {
+	ID             uint64    `json:"id" gorm:"primaryKey;autoIncrement"`
+	NotifyID       string    `json:"notify_id" gorm:"type:varchar(128);uniqueIndex"`
+	OrderID        string    `json:"order_id" gorm:"type:varchar(64);index"`
+	OutTradeNo     string    `json:"out_trade_no" gorm:"type:varchar(64);index"`
+	TradeNo        string    `json:"trade_no" gorm:"type:varchar(64)"`
+	TradeStatus    string    `json:"trade_status" gorm:"type:varchar(64)"`
+	DuplicateCount int       `json:"duplicate_count" gorm:"not null;default:0"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
+
+func (ProcessedNotification) TableName() string {
+	return "processed_notification"
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ProcessedNotificationStore interface {
+	// RecordDuplicate 在 notify_id 已处理过时累加重复投递次数并返回 true。
+	RecordDuplicate(notifyID string) (bool, error)
+	// MarkProcessed 记录通知已处理，notify_id 已存在时返回 false。
+	MarkProcessed(n *ProcessedNotification) (bool, error)
+}
+
+type InMemoryProcessedNotificationStore struct {
+	mu            sync.Mutex
+	notifications map[string]*ProcessedNotification
+}
+
+var ProcessedNotifications ProcessedNotificationStore = &InMemoryProcessedNotificationStore{notifications: make(map[string]*ProcessedNotification)}
+
+func (s *InMemoryProcessedNotificationStore) RecordDuplicate(notifyID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, exists := s.notifications[notifyID]
+	if !exists {
+		return false, nil
+	}
+	n.DuplicateCount++
+	n.LastSeenAt = time.Now()
+	return true, nil
+}
+
+func (s *InMemoryProcessedNotificationStore) MarkProcessed(n *ProcessedNotification) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.notifications[n.NotifyID]; exists {
+		return false, nil
+	}
+	now := time.Now()
+	n.CreatedAt = now
+	n.LastSeenAt = now
+	s.notifications[n.NotifyID] = n
+	return true, nil
+}
+
+type GormProcessedNotificationStore struct {
+	db *gorm.DB
+}
+
+func InitGormProcessedNotificationStore(db *gorm.DB) error {
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	if err := db.AutoMigrate(&ProcessedNotification{}); err != nil {
+		return err
+	}
+	ProcessedNotifications = &GormProcessedNotificationStore{db: db}
+	return nil
+}
+
+func (s *GormProcessedNotificationStore) RecordDuplicate(notifyID string) (bool, error) {
+	res := s.db.Model(&ProcessedNotification{}).Where("notify_id = ?", notifyID).Updates(map[string]any{
+		"duplicate_count": gorm.Expr("duplicate_count + 1"),
+		"last_seen_at":    time.Now(),
+	})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (s *GormProcessedNotificationStore) MarkProcessed(n *ProcessedNotification) (bool, error) {
+	now := time.Now()
+	n.CreatedAt = now
+	n.LastSeenAt = now
+	res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(n)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+type ReconciliationDiffType string
+
+const (
+	// DiffMissingLocal 支付宝账单中有，本地没有对应订单或退款
+	DiffMissingLocal ReconciliationDiffType = "missing_local"
+	// DiffMissingRemote 本地已支付或已退款，支付宝账单中没有
+	DiffMissingRemote ReconciliationDiffType = "missing_remote"
+	// DiffAmountMismatch 双方都有，金额不一致
+	DiffAmountMismatch ReconciliationDiffType = "amount_mismatch"
+	// DiffStatusMismatch 支付宝已入账，本地状态不是已支付或已退款
+	DiffStatusMismatch ReconciliationDiffType = "status_mismatch"
+	// DiffTradeNoMismatch 双方都有，支付宝交易号与本地记录的不一致
+	DiffTradeNoMismatch ReconciliationDiffType = "trade_no_mismatch"
+)
+
+// ReconciliationDiff 是支付宝日账单与本地订单、退款核对出的一条差异。
+type ReconciliationDiff struct {
+	ID            uint64                 `json:"id" gorm:"primaryKey;autoIncrement"`
+	BillDate      string                 `json:"bill_date" gorm:"type:varchar(10);index"`
+	DiffType      ReconciliationDiffType `json:"diff_type" gorm:"type:varchar(32);index"`
+	OrderID       string                 `json:"order_id,omitempty" gorm:"type:varchar(64);index"`
+	RefundID      string                 `json:"refund_id,omitempty" gorm:"type:varchar(64)"`
+	OutTradeNo    string                 `json:"out_trade_no,omitempty" gorm:"type:varchar(64);index"`
+	TradeNo       string                 `json:"trade_no,omitempty" gorm:"type:varchar(64)"`
+	OutRequestNo  string                 `json:"out_request_no,omitempty" gorm:"type:varchar(64)"`
+	LocalAmount   Money                  `json:"local_amount" gorm:"column:local_amount_fen;not null;default:0"`
+	RemoteAmount  Money                  `json:"remote_amount" gorm:"column:remote_amount_fen;not null;default:0"`
+	LocalStatus   string                 `json:"local_status,omitempty" gorm:"type:varchar(32)"`
+	RemoteBizType string                 `json:"remote_biz_type,omitempty" gorm:"type:varchar(16)"`
+	Detail        string                 `json:"detail,omitempty" gorm:"type:varchar(255)"`
+	CreatedAt     time.Time              `json:"created_at"`
+}
+
+func (ReconciliationDiff) TableName() string {
+	return "reconciliation_diff"
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReconciliationDiffStore interface {
+	// ReplaceForDate 用本次核对结果替换该账单日之前的差异，重复核对同一天不会累积记录。
+	ReplaceForDate(billDate string, diffs []*ReconciliationDiff) error
+	ListByDate(billDate string) []*ReconciliationDiff
+}
+
+type InMemoryReconciliationDiffStore struct {
+	mu    sync.RWMutex
+	diffs map[string][]*ReconciliationDiff
+}
+
+var ReconciliationDiffs ReconciliationDiffStore = &InMemoryReconciliationDiffStore{diffs: make(map[string][]*ReconciliationDiff)}
+
+func (s *InMemoryReconciliationDiffStore) ReplaceForDate(billDate string, diffs []*ReconciliationDiff) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for i, d := range diffs {
+		d.ID = uint64(i + 1)
+		d.BillDate = billDate
+		d.CreatedAt = now
+	}
+	s.diffs[billDate] = diffs
+	return nil
+}
+
+func (s *InMemoryReconciliationDiffStore) ListByDate(billDate string) []*ReconciliationDiff {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	diffs := make([]*ReconciliationDiff, len(s.diffs[billDate]))
+	copy(diffs, s.diffs[billDate])
+	return diffs
+}
+
+type GormReconciliationDiffStore struct {
+	db *gorm.DB
+}
+
+func InitGormReconciliationDiffStore(db *gorm.DB) error {
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	if err := db.AutoMigrate(&ReconciliationDiff{}); err != nil {
+		return err
+	}
+	ReconciliationDiffs = &GormReconciliationDiffStore{db: db}
+	return nil
+}
+
+func (s *GormReconciliationDiffStore) ReplaceForDate(billDate string, diffs []*ReconciliationDiff) error {
+	now := time.Now()
+	for _, d := range diffs {
+		d.BillDate = billDate
+		d.CreatedAt = now
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bill_date = ?", billDate).Delete(&ReconciliationDiff{}).Error; err != nil {
+			return err
+		}
+		if len(diffs) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(diffs, 200).Error
+	})
+}
+
+func (s *GormReconciliationDiffStore) ListByDate(billDate string) []*ReconciliationDiff {
+	var diffs []*ReconciliationDiff
+	_ = s.db.Where("bill_date = ?", billDate).Order("id asc").Find(&diffs).Error
+	return diffs
+}
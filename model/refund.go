@@ -0,0 +1,38 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRefundExceedsBalance 表示登记退款后，订单上未失败的退款合计会超过订单金额。
+var ErrRefundExceedsBalance = errors.New("refund exceeds refundable balance")
+
+type RefundStatus string
+
+const (
+	RefundStatusPending    RefundStatus = "pending"
+	RefundStatusProcessing RefundStatus = "processing"
+	RefundStatusSuccess    RefundStatus = "success"
+	RefundStatusFailed     RefundStatus = "failed"
+)
+
+type Refund struct {
+	ID           string       `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	OrderID      string       `json:"order_id" gorm:"type:varchar(64);index"`
+	OutTradeNo   string       `json:"out_trade_no" gorm:"type:varchar(64);index"`
+	TradeNo      string       `json:"trade_no,omitempty" gorm:"type:varchar(64)"`
+	OutRequestNo string       `json:"out_request_no" gorm:"uniqueIndex;type:varchar(64)"`
+	RefundAmount Money        `json:"refund_amount" gorm:"column:refund_amount_fen;not null;default:0"`
+	RefundReason string       `json:"refund_reason,omitempty" gorm:"type:varchar(255)"`
+	Status       RefundStatus `json:"status" gorm:"type:varchar(16);index"`
+	FundChange   string       `json:"fund_change,omitempty" gorm:"type:varchar(8)"`
+	ErrorCode    string       `json:"error_code,omitempty" gorm:"type:varchar(64)"`
+	ErrorMsg     string       `json:"error_msg,omitempty" gorm:"type:text"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+func (Refund) TableName() string {
+	return "refund"
+}
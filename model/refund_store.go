@@ -0,0 +1,302 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RefundStore interface {
+	Create(refund *Refund) error
+	GetByID(id string) (*Refund, bool)
+	GetByOutRequestNo(outRequestNo string) (*Refund, bool)
+	ListByOrderID(orderID string) []*Refund
+	// Reserve 在订单可退余额内登记退款：ID 为空时插入新退款，否则把已失败的退款改回 pending 重新发起。
+	// 余额校验和写入在同一把锁或事务中完成，同一订单的并发退款合计不会超过 total。
+	// 余额不足时返回 ErrRefundExceedsBalance 和当前可退余额。
+	Reserve(refund *Refund, total Money) (Money, error)
+	// Update 保存退款的处理结果。退款第一次变为 success 时，在同一事务中写入 refund.succeeded 事件。
+	Update(refund *Refund) error
+	// ListSucceededBetween 返回在 [start, end) 内退款成功的记录，以最后更新时间为准。
+	ListSucceededBetween(start, end time.Time) []*Refund
+}
+
+type InMemoryRefundStore struct {
+	mu      sync.RWMutex
+	refunds map[string]*Refund
+	// succeeded 记录已经写过 refund.succeeded 事件的退款。调用方拿到的是共享指针，
+	// 无法通过对比旧记录判断是否第一次成功
+	succeeded map[string]bool
+}
+
+var Refunds RefundStore = &InMemoryRefundStore{refunds: make(map[string]*Refund), succeeded: make(map[string]bool)}
+
+func (s *InMemoryRefundStore) Create(refund *Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.refunds {
+		if r.OutRequestNo == refund.OutRequestNo {
+			return errors.New("duplicate out_request_no")
+		}
+	}
+
+	if refund.ID == "" {
+		refund.ID = generateID()
+	}
+	refund.CreatedAt = time.Now()
+	refund.UpdatedAt = time.Now()
+	if refund.Status == "" {
+		refund.Status = RefundStatusPending
+	}
+
+	s.refunds[refund.ID] = refund
+	return nil
+}
+
+func (s *InMemoryRefundStore) GetByID(id string) (*Refund, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refund, exists := s.refunds[id]
+	return refund, exists
+}
+
+func (s *InMemoryRefundStore) GetByOutRequestNo(outRequestNo string) (*Refund, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, refund := range s.refunds {
+		if refund.OutRequestNo == outRequestNo {
+			return refund, true
+		}
+	}
+	return nil, false
+}
+
+func (s *InMemoryRefundStore) ListByOrderID(orderID string) []*Refund {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refunds := make([]*Refund, 0)
+	for _, refund := range s.refunds {
+		if refund.OrderID == orderID {
+			refunds = append(refunds, refund)
+		}
+	}
+	sort.Slice(refunds, func(i, j int) bool {
+		return refunds[i].CreatedAt.Before(refunds[j].CreatedAt)
+	})
+	return refunds
+}
+
+func (s *InMemoryRefundStore) Reserve(refund *Refund, total Money) (Money, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var refunded Money
+	for _, r := range s.refunds {
+		if r.OrderID == refund.OrderID && r.ID != refund.ID && r.Status != RefundStatusFailed {
+			refunded += r.RefundAmount
+		}
+	}
+	if refunded+refund.RefundAmount > total {
+		return total - refunded, ErrRefundExceedsBalance
+	}
+
+	now := time.Now()
+	if refund.ID != "" {
+		if r, exists := s.refunds[refund.ID]; !exists || r.Status != RefundStatusFailed {
+			// 另一个请求已经重新发起了这笔退款
+			return 0, ErrConcurrentUpdate
+		}
+		refund.Status = RefundStatusPending
+		refund.UpdatedAt = now
+		s.refunds[refund.ID] = refund
+		return total - refunded - refund.RefundAmount, nil
+	}
+	for _, r := range s.refunds {
+		if r.OutRequestNo == refund.OutRequestNo {
+			return 0, errors.New("duplicate out_request_no")
+		}
+	}
+	refund.ID = generateID()
+	refund.CreatedAt = now
+	refund.UpdatedAt = now
+	refund.Status = RefundStatusPending
+	s.refunds[refund.ID] = refund
+	return total - refunded - refund.RefundAmount, nil
+}
+
+func (s *InMemoryRefundStore) Update(refund *Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.refunds[refund.ID]; !exists {
+		return nil
+	}
+	refund.UpdatedAt = time.Now()
+	s.refunds[refund.ID] = refund
+	if refund.Status == RefundStatusSuccess && !s.succeeded[refund.ID] {
+		s.succeeded[refund.ID] = true
+		memOrderEvents.add(newRefundEvent(refund, refund.UpdatedAt))
+	}
+	return nil
+}
+
+func (s *InMemoryRefundStore) ListSucceededBetween(start, end time.Time) []*Refund {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refunds := make([]*Refund, 0)
+	for _, refund := range s.refunds {
+		if refund.Status == RefundStatusSuccess && !refund.UpdatedAt.Before(start) && refund.UpdatedAt.Before(end) {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds
+}
+
+type GormRefundStore struct {
+	db *gorm.DB
+}
+
+func InitGormRefundStore(db *gorm.DB) error {
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	if err := db.AutoMigrate(&Refund{}); err != nil {
+		return err
+	}
+	if err := backfillMoneyColumn(db, &Refund{}, "refund_amount", "refund_amount_fen"); err != nil {
+		return err
+	}
+	Refunds = &GormRefundStore{db: db}
+	return nil
+}
+
+func (s *GormRefundStore) Create(refund *Refund) error {
+	if refund.ID == "" {
+		refund.ID = generateID()
+	}
+	now := time.Now()
+	if refund.CreatedAt.IsZero() {
+		refund.CreatedAt = now
+	}
+	refund.UpdatedAt = now
+	if refund.Status == "" {
+		refund.Status = RefundStatusPending
+	}
+	return s.db.Create(refund).Error
+}
+
+func (s *GormRefundStore) GetByID(id string) (*Refund, bool) {
+	var refund Refund
+	if err := s.db.First(&refund, "id = ?", id).Error; err != nil {
+		return nil, false
+	}
+	return &refund, true
+}
+
+func (s *GormRefundStore) GetByOutRequestNo(outRequestNo string) (*Refund, bool) {
+	var refund Refund
+	if err := s.db.First(&refund, "out_request_no = ?", outRequestNo).Error; err != nil {
+		return nil, false
+	}
+	return &refund, true
+}
+
+func (s *GormRefundStore) ListByOrderID(orderID string) []*Refund {
+	var refunds []*Refund
+	_ = s.db.Where("order_id = ?", orderID).Order("created_at asc").Find(&refunds).Error
+	return refunds
+}
+
+func (s *GormRefundStore) Reserve(refund *Refund, total Money) (Money, error) {
+	var refundable Money
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁住订单行，同一订单的退款登记串行执行，余额校验读到的是已提交的退款
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			First(&Order{}, "id = ?", refund.OrderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+
+		var refunded int64
+		if err := tx.Model(&Refund{}).
+			Where("order_id = ? AND id <> ? AND status <> ?", refund.OrderID, refund.ID, RefundStatusFailed).
+			Select("COALESCE(SUM(refund_amount_fen), 0)").Scan(&refunded).Error; err != nil {
+			return err
+		}
+		refundable = total - Money(refunded)
+		if refund.RefundAmount > refundable {
+			return ErrRefundExceedsBalance
+		}
+		refundable -= refund.RefundAmount
+
+		now := time.Now()
+		refund.Status = RefundStatusPending
+		refund.UpdatedAt = now
+		if refund.ID != "" {
+			res := tx.Model(&Refund{}).Where("id = ? AND status = ?", refund.ID, RefundStatusFailed).
+				Updates(map[string]any{"status": refund.Status, "updated_at": now})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				// 另一个请求已经重新发起了这笔退款
+				return ErrConcurrentUpdate
+			}
+			return nil
+		}
+		refund.ID = generateID()
+		refund.CreatedAt = now
+		return tx.Create(refund).Error
+	})
+	if errors.Is(err, ErrRefundExceedsBalance) {
+		return refundable, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	return refundable, nil
+}
+
+func (s *GormRefundStore) Update(refund *Refund) error {
+	refund.UpdatedAt = time.Now()
+	fields := map[string]any{
+		"trade_no":    refund.TradeNo,
+		"status":      refund.Status,
+		"fund_change": refund.FundChange,
+		"error_code":  refund.ErrorCode,
+		"error_msg":   refund.ErrorMsg,
+		"updated_at":  refund.UpdatedAt,
+	}
+	if refund.Status != RefundStatusSuccess {
+		return s.db.Model(&Refund{}).Where("id = ?", refund.ID).Updates(fields).Error
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// 只有从非 success 变为 success 的那次更新写事件，并发的同步请求只会有一个命中
+		res := tx.Model(&Refund{}).Where("id = ? AND status <> ?", refund.ID, RefundStatusSuccess).Updates(fields)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return tx.Model(&Refund{}).Where("id = ?", refund.ID).Updates(fields).Error
+		}
+		return tx.Create(newRefundEvent(refund, refund.UpdatedAt)).Error
+	})
+}
+
+func (s *GormRefundStore) ListSucceededBetween(start, end time.Time) []*Refund {
+	var refunds []*Refund
+	_ = s.db.Where("status = ? AND updated_at >= ? AND updated_at < ?", RefundStatusSuccess, start, end).Find(&refunds).Error
+	return refunds
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestRefundReserveConcurrent(t *testing.T) {
+	store := &InMemoryRefundStore{refunds: make(map[string]*Refund), succeeded: make(map[string]bool)}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			refund := &Refund{OrderID: "order-reserve", OutRequestNo: fmt.Sprintf("req-%d", i), RefundAmount: 300}
+			_, errs[i] = store.Reserve(refund, 1000)
+		}(i)
+	}
+	wg.Wait()
+
+	reserved := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			reserved++
+		case !errors.Is(err, ErrRefundExceedsBalance):
+			t.Fatal(err)
+		}
+	}
+	if reserved != 3 {
+		t.Fatalf("reserved = %d, want 3", reserved)
+	}
+
+	// 失败的退款释放余额，重新发起时再次占用
+	failed := store.ListByOrderID("order-reserve")[0]
+	failed.Status = RefundStatusFailed
+	if err := store.Update(failed); err != nil {
+		t.Fatal(err)
+	}
+	refundable, err := store.Reserve(&Refund{OrderID: "order-reserve", OutRequestNo: "req-new", RefundAmount: 300}, 1000)
+	if err != nil || refundable != 100 {
+		t.Fatalf("reserve after failure = %s, %v; want 1.00", refundable, err)
+	}
+	if _, err := store.Reserve(failed, 1000); !errors.Is(err, ErrRefundExceedsBalance) {
+		t.Fatalf("retry failed refund error = %v, want ErrRefundExceedsBalance", err)
+	}
+}
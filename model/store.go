@@ -1,6 +1,7 @@
 package model
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -9,13 +10,27 @@ type OrderStore interface {
 	Create(order *Order) error
 	GetByID(id string) (*Order, bool)
 	GetByOutTradeNo(outTradeNo string) (*Order, bool)
-	UpdateStatus(id string, status OrderStatus, tradeNo string) error
+	// UpdateStatus 把订单推进到 status，只要流转合法，不关心当前是什么状态。
+	UpdateStatus(id string, status OrderStatus, tradeNo string, change StatusChange) error
+	// TransitionStatus 仅当订单的状态和 version 仍与读取到的 from 一致时才改为 to，否则返回 ErrConcurrentUpdate。
+	TransitionStatus(from *Order, to OrderStatus, tradeNo string, change StatusChange) error
 	List() []*Order
+	ListStatusHistory(orderID string) []*OrderStatusHistory
+	// ListDueForReconcile 返回 next_reconcile_at 已到期的 pending 订单，最早到期的在前。
+	ListDueForReconcile(now time.Time, limit int) []*Order
+	// ClaimReconcile 仅当对账次数仍是 attempts 时把它加一并把下次对账推迟到 next，
+	// 多个实例同时扫描到同一订单时只有一个能领取成功。
+	ClaimReconcile(id string, attempts int, next time.Time) (bool, error)
+	// ListPaidBetween 返回支付宝付款时间 gmt_payment 在 [start, end) 内的订单，用于与支付宝日账单核对。
+	ListPaidBetween(start, end time.Time) []*Order
 }
 
+// InMemoryOrderStore 保存订单的副本，读写都复制，调用方拿到的订单与 GORM 存储一样是读取时的快照，
+// TransitionStatus 的 version 比较才有意义。
 type InMemoryOrderStore struct {
-	mu     sync.RWMutex
-	orders map[string]*Order
+	mu      sync.RWMutex
+	orders  map[string]*Order
+	history []*OrderStatusHistory
 }
 
 var Store OrderStore = &InMemoryOrderStore{orders: make(map[string]*Order)}
@@ -28,8 +43,10 @@ func (s *InMemoryOrderStore) Create(order *Order) error {
 	order.CreatedAt = time.Now()
 	order.UpdatedAt = time.Now()
 	order.Status = OrderStatusPending
+	setOrderDefaults(order)
 
-	s.orders[order.ID] = order
+	stored := *order
+	s.orders[order.ID] = &stored
 	return nil
 }
 
@@ -38,7 +55,11 @@ func (s *InMemoryOrderStore) GetByID(id string) (*Order, bool) {
 	defer s.mu.RUnlock()
 
 	order, exists := s.orders[id]
-	return order, exists
+	if !exists {
+		return nil, false
+	}
+	copied := *order
+	return &copied, true
 }
 
 func (s *InMemoryOrderStore) GetByOutTradeNo(outTradeNo string) (*Order, bool) {
@@ -47,28 +68,65 @@ func (s *InMemoryOrderStore) GetByOutTradeNo(outTradeNo string) (*Order, bool) {
 
 	for _, order := range s.orders {
 		if order.OutTradeNo == outTradeNo {
-			return order, true
+			copied := *order
+			return &copied, true
 		}
 	}
 	return nil, false
 }
 
-func (s *InMemoryOrderStore) UpdateStatus(id string, status OrderStatus, tradeNo string) error {
+func (s *InMemoryOrderStore) UpdateStatus(id string, status OrderStatus, tradeNo string, change StatusChange) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	order, exists := s.orders[id]
 	if !exists {
-		return nil
+		return ErrOrderNotFound
 	}
+	if err := checkTransition(id, order.Status, status); err != nil {
+		return err
+	}
+
+	s.applyStatus(order, status, tradeNo, change)
+	return nil
+}
+
+func (s *InMemoryOrderStore) TransitionStatus(from *Order, to OrderStatus, tradeNo string, change StatusChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkTransition(from.ID, from.Status, to); err != nil {
+		return err
+	}
+	order, exists := s.orders[from.ID]
+	if !exists {
+		return ErrOrderNotFound
+	}
+	if order.Status != from.Status || order.Version != from.Version {
+		return ErrConcurrentUpdate
+	}
+
+	s.applyStatus(order, to, tradeNo, change)
+	return nil
+}
 
+func (s *InMemoryOrderStore) applyStatus(order *Order, status OrderStatus, tradeNo string, change StatusChange) {
+	now := time.Now()
+	from := order.Status
 	order.Status = status
-	order.UpdatedAt = time.Now()
+	order.UpdatedAt = now
+	order.Version++
 	if tradeNo != "" {
 		order.TradeNo = tradeNo
 	}
-
-	return nil
+	if status == OrderStatusPaid && order.GmtPayment == nil {
+		paidAt := change.paidAt(now)
+		order.GmtPayment = &paidAt
+	}
+	if from != status {
+		s.history = append(s.history, newStatusHistory(order.ID, from, status, tradeNo, change, now))
+		memOrderEvents.add(newOrderEvent(order, from, change, now))
+	}
 }
 
 func (s *InMemoryOrderStore) List() []*Order {
@@ -77,11 +135,85 @@ func (s *InMemoryOrderStore) List() []*Order {
 
 	orders := make([]*Order, 0, len(s.orders))
 	for _, order := range s.orders {
-		orders = append(orders, order)
+		copied := *order
+		orders = append(orders, &copied)
+	}
+	return orders
+}
+
+func (s *InMemoryOrderStore) ListStatusHistory(orderID string) []*OrderStatusHistory {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := make([]*OrderStatusHistory, 0)
+	for _, h := range s.history {
+		if h.OrderID == orderID {
+			history = append(history, h)
+		}
+	}
+	return history
+}
+
+func (s *InMemoryOrderStore) ListDueForReconcile(now time.Time, limit int) []*Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := make([]*Order, 0)
+	for _, order := range s.orders {
+		if order.Status == OrderStatusPending && !order.NextReconcileAt.After(now) {
+			copied := *order
+			orders = append(orders, &copied)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].NextReconcileAt.Before(orders[j].NextReconcileAt)
+	})
+	if limit > 0 && len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders
+}
+
+func (s *InMemoryOrderStore) ClaimReconcile(id string, attempts int, next time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, exists := s.orders[id]
+	if !exists || order.Status != OrderStatusPending || order.ReconcileAttempts != attempts {
+		return false, nil
+	}
+	order.ReconcileAttempts++
+	order.NextReconcileAt = next
+	return true, nil
+}
+
+func (s *InMemoryOrderStore) ListPaidBetween(start, end time.Time) []*Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := make([]*Order, 0)
+	for _, order := range s.orders {
+		if order.GmtPayment == nil || order.GmtPayment.Before(start) || !order.GmtPayment.Before(end) {
+			continue
+		}
+		copied := *order
+		orders = append(orders, &copied)
 	}
 	return orders
 }
 
+func setOrderDefaults(order *Order) {
+	if order.Currency == "" {
+		order.Currency = CurrencyCNY
+	}
+	if order.ExpiresAt.IsZero() {
+		order.ExpiresAt = order.CreatedAt.Add(DefaultOrderTimeout)
+	}
+	if order.NextReconcileAt.IsZero() {
+		order.NextReconcileAt = order.CreatedAt
+	}
+}
+
 func generateID() string {
 	return time.Now().Format("20060102150405") + randomString(6)
 }
@@ -2,6 +2,8 @@ package model
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,16 +17,101 @@ func InitGormOrderStore(db *gorm.DB) error {
 	if db == nil {
 		return errors.New("db is nil")
 	}
-	if err := db.AutoMigrate(&Order{}); err != nil {
+	if err := db.AutoMigrate(&Order{}, &OrderStatusHistory{}, &OrderEvent{}); err != nil {
+		return err
+	}
+	if err := backfillMoneyColumn(db, &Order{}, "total_amount", "total_amount_fen"); err != nil {
+		return err
+	}
+	// 新增对账列之前创建的订单没有这两列的值，按创建时间补齐，否则后台任务永远扫不到它们
+	if err := db.Model(&Order{}).Where("expires_at IS NULL").
+		Update("expires_at", gorm.Expr("DATE_ADD(created_at, INTERVAL ? SECOND)", int(DefaultOrderTimeout.Seconds()))).Error; err != nil {
+		return err
+	}
+	// 新增 gmt_payment 之前已支付的订单没有付款时间，用第一次变为 paid 的时间补齐
+	paid := db.Model(&OrderStatusHistory{}).Select("order_id").Where("to_status = ?", OrderStatusPaid)
+	if err := db.Model(&Order{}).Where("gmt_payment IS NULL AND id IN (?)", paid).
+		Update("gmt_payment", gorm.Expr("(SELECT MIN(h.created_at) FROM order_status_history h WHERE h.order_id = orders.id AND h.to_status = ?)", OrderStatusPaid)).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&Order{}).Where("next_reconcile_at IS NULL").
+		Update("next_reconcile_at", gorm.Expr("created_at")).Error; err != nil {
 		return err
 	}
 	if err := InitGormCallbackLogStore(db); err != nil {
 		return err
 	}
+	if err := InitGormRefundStore(db); err != nil {
+		return err
+	}
+	if err := InitGormProcessedNotificationStore(db); err != nil {
+		return err
+	}
+	if err := InitGormIdempotencyStore(db); err != nil {
+		return err
+	}
+	if err := InitGormJobLockStore(db); err != nil {
+		return err
+	}
+	if err := InitGormReconciliationDiffStore(db); err != nil {
+		return err
+	}
+	if err := InitGormWebhookStore(db); err != nil {
+		return err
+	}
 	Store = &GormOrderStore{db: db}
+	OrderEvents = &GormOrderEventStore{db: db}
 	return nil
 }
 
+// backfillMoneyColumn 把旧版 varchar 金额列换算成分写入新列，旧列保留不删。
+// 旧值逐行用 ParseMoney 校验，存在无法解析的金额时整体不回填并返回带行 ID 的错误，
+// 由人工修正数据后重新启动，避免把脏数据换算成错误的金额。
+func backfillMoneyColumn(db *gorm.DB, model any, legacy, column string) error {
+	if !db.Migrator().HasColumn(model, legacy) {
+		return nil
+	}
+
+	var rows []struct {
+		ID     string
+		Legacy string
+	}
+	if err := db.Model(model).
+		Select("id, " + legacy + " AS legacy").
+		Where(column + " = 0 AND " + legacy + " <> ''").
+		Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	amounts := make(map[string]Money, len(rows))
+	var bad []string
+	for _, row := range rows {
+		m, err := ParseMoney(strings.TrimSpace(row.Legacy))
+		if err != nil {
+			bad = append(bad, fmt.Sprintf("%s(%q)", row.ID, row.Legacy))
+			continue
+		}
+		amounts[row.ID] = m
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("backfill %s: %d rows have invalid %s: %s", column, len(bad), legacy, strings.Join(bad, ", "))
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for id, m := range amounts {
+			if err := tx.Model(model).
+				Where("id = ? AND "+column+" = 0", id).
+				Update(column, m).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s *GormOrderStore) Create(order *Order) error {
 	if order.ID == "" {
 		order.ID = generateID()
@@ -37,6 +124,7 @@ func (s *GormOrderStore) Create(order *Order) error {
 	if order.Status == "" {
 		order.Status = OrderStatusPending
 	}
+	setOrderDefaults(order)
 	return s.db.Create(order).Error
 }
 
@@ -64,15 +152,82 @@ func (s *GormOrderStore) GetByOutTradeNo(outTradeNo string) (*Order, bool) {
 	return &order, true
 }
 
-func (s *GormOrderStore) UpdateStatus(id string, status OrderStatus, tradeNo string) error {
+// updateStatusAttempts 是 UpdateStatus 遇到并发修改时重新读取并重试的次数。
+const updateStatusAttempts = 3
+
+func (s *GormOrderStore) UpdateStatus(id string, status OrderStatus, tradeNo string, change StatusChange) error {
+	for i := 0; i < updateStatusAttempts; i++ {
+		var order Order
+		err := s.db.Select("id", "status", "version").First(&order, "id = ?", id).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		if err := checkTransition(id, order.Status, status); err != nil {
+			return err
+		}
+
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			return casStatus(tx, id, order.Status, status, tradeNo, change, "version = ?", order.Version)
+		})
+		if !errors.Is(err, ErrConcurrentUpdate) {
+			return err
+		}
+	}
+	return ErrConcurrentUpdate
+}
+
+func (s *GormOrderStore) TransitionStatus(from *Order, to OrderStatus, tradeNo string, change StatusChange) error {
+	if err := checkTransition(from.ID, from.Status, to); err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return casStatus(tx, from.ID, from.Status, to, tradeNo, change, "status = ? AND version = ?", from.Status, from.Version)
+	})
+}
+
+// casStatus 在 cond 仍然成立时更新状态并递增 version，同时写入状态历史和 outbox 事件。
+// version 每次都递增，这样 MySQL 按“实际变更行数”返回的 RowsAffected 也不会把无变化误判为冲突。
+func casStatus(tx *gorm.DB, id string, from, to OrderStatus, tradeNo string, change StatusChange, cond string, args ...any) error {
+	now := time.Now()
 	updates := map[string]any{
-		"status":     status,
-		"updated_at": time.Now(),
+		"status":     to,
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": now,
 	}
 	if tradeNo != "" {
 		updates["trade_no"] = tradeNo
 	}
-	return s.db.Model(&Order{}).Where("id = ?", id).Updates(updates).Error
+	if to == OrderStatusPaid {
+		updates["gmt_payment"] = gorm.Expr("COALESCE(gmt_payment, ?)", change.paidAt(now))
+	}
+	res := tx.Model(&Order{}).Where("id = ?", id).Where(cond, args...).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		var count int64
+		if err := tx.Model(&Order{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrOrderNotFound
+		}
+		return ErrConcurrentUpdate
+	}
+	if from == to {
+		return nil
+	}
+	if err := tx.Create(newStatusHistory(id, from, to, tradeNo, change, now)).Error; err != nil {
+		return err
+	}
+	var order Order
+	if err := tx.First(&order, "id = ?", id).Error; err != nil {
+		return err
+	}
+	return tx.Create(newOrderEvent(&order, from, change, now)).Error
 }
 
 func (s *GormOrderStore) List() []*Order {
@@ -80,3 +235,35 @@ func (s *GormOrderStore) List() []*Order {
 	_ = s.db.Order("created_at desc").Find(&orders).Error
 	return orders
 }
+
+func (s *GormOrderStore) ListDueForReconcile(now time.Time, limit int) []*Order {
+	var orders []*Order
+	_ = s.db.Where("status = ? AND next_reconcile_at <= ?", OrderStatusPending, now).
+		Order("next_reconcile_at asc").Limit(limit).Find(&orders).Error
+	return orders
+}
+
+func (s *GormOrderStore) ClaimReconcile(id string, attempts int, next time.Time) (bool, error) {
+	res := s.db.Model(&Order{}).
+		Where("id = ? AND status = ? AND reconcile_attempts = ?", id, OrderStatusPending, attempts).
+		Updates(map[string]any{
+			"reconcile_attempts": gorm.Expr("reconcile_attempts + 1"),
+			"next_reconcile_at":  next,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (s *GormOrderStore) ListPaidBetween(start, end time.Time) []*Order {
+	var orders []*Order
+	_ = s.db.Where("gmt_payment >= ? AND gmt_payment < ?", start, end).Find(&orders).Error
+	return orders
+}
+
+func (s *GormOrderStore) ListStatusHistory(orderID string) []*OrderStatusHistory {
+	var history []*OrderStatusHistory
+	_ = s.db.Where("order_id = ?", orderID).Order("id asc").Find(&history).Error
+	return history
+}
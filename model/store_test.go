@@ -0,0 +1,75 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTransitionStatusRejectsStaleVersion(t *testing.T) {
+	store := &InMemoryOrderStore{orders: make(map[string]*Order)}
+	order := &Order{OutTradeNo: "otn-stale", TotalAmount: 100}
+	if err := store.Create(order); err != nil {
+		t.Fatal(err)
+	}
+	stale := *order
+
+	// 同状态的更新（例如补写 trade_no）也会递增 version
+	if err := store.UpdateStatus(order.ID, OrderStatusPending, "trade-1", StatusChange{Source: TransitionSourceSync}); err != nil {
+		t.Fatal(err)
+	}
+	err := store.TransitionStatus(&stale, OrderStatusClosed, "", StatusChange{Source: TransitionSourceAPI})
+	if !errors.Is(err, ErrConcurrentUpdate) {
+		t.Fatalf("stale transition error = %v, want ErrConcurrentUpdate", err)
+	}
+
+	current, _ := store.GetByID(order.ID)
+	if err := store.TransitionStatus(current, OrderStatusClosed, "", StatusChange{Source: TransitionSourceAPI}); err != nil {
+		t.Fatal(err)
+	}
+	current, _ = store.GetByID(order.ID)
+	if current.Status != OrderStatusClosed || current.Version != stale.Version+2 {
+		t.Fatalf("order = %s v%d, want closed v%d", current.Status, current.Version, stale.Version+2)
+	}
+}
+
+func TestTransitionStatusConcurrent(t *testing.T) {
+	store := &InMemoryOrderStore{orders: make(map[string]*Order)}
+	order := &Order{OutTradeNo: "otn-race", TotalAmount: 100}
+	if err := store.Create(order); err != nil {
+		t.Fatal(err)
+	}
+
+	// 通知和关单同时读到 pending，只有一个能完成流转
+	targets := []OrderStatus{OrderStatusPaid, OrderStatusClosed, OrderStatusPaid, OrderStatusClosed}
+	errs := make([]error, len(targets))
+	snapshots := make([]*Order, len(targets))
+	for i := range targets {
+		snapshots[i], _ = store.GetByID(order.ID)
+	}
+	var wg sync.WaitGroup
+	for i, to := range targets {
+		wg.Add(1)
+		go func(i int, to OrderStatus) {
+			defer wg.Done()
+			errs[i] = store.TransitionStatus(snapshots[i], to, "", StatusChange{Source: TransitionSourceAPI})
+		}(i, to)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrConcurrentUpdate):
+			t.Fatal(err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("succeeded = %d, want 1", succeeded)
+	}
+	if history := store.ListStatusHistory(order.ID); len(history) != 1 {
+		t.Fatalf("history = %d entries, want 1", len(history))
+	}
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+type WebhookEventType string
+
+const (
+	WebhookEventOrderPaid       WebhookEventType = "order.paid"
+	WebhookEventOrderClosed     WebhookEventType = "order.closed"
+	WebhookEventRefundSucceeded WebhookEventType = "refund.succeeded"
+)
+
+var WebhookEventTypes = []WebhookEventType{WebhookEventOrderPaid, WebhookEventOrderClosed, WebhookEventRefundSucceeded}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	// WebhookDeliveryFailed 表示重试次数用尽，只能手动重新投递
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookEndpoint 是业务方登记的回调地址。Events 为逗号分隔的事件类型，为空表示订阅全部事件。
+type WebhookEndpoint struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	URL         string    `json:"url" gorm:"type:varchar(1024)"`
+	Secret      string    `json:"-" gorm:"type:varchar(128)"`
+	Events      string    `json:"events" gorm:"type:varchar(255)"`
+	Description string    `json:"description,omitempty" gorm:"type:varchar(255)"`
+	Enabled     bool      `json:"enabled" gorm:"not null;default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (WebhookEndpoint) TableName() string {
+	return "webhook_endpoint"
+}
+
+func (e *WebhookEndpoint) Subscribes(eventType WebhookEventType) bool {
+	if e.Events == "" {
+		return true
+	}
+	for _, t := range strings.Split(e.Events, ",") {
+		if WebhookEventType(strings.TrimSpace(t)) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery 是一个事件对一个回调地址的投递任务，Payload 为签名时使用的原始 JSON。
+type WebhookDelivery struct {
+	ID             string                `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	EndpointID     string                `json:"endpoint_id" gorm:"type:varchar(64);index;uniqueIndex:idx_webhook_delivery_event_endpoint,priority:2"`
+	EventID        string                `json:"event_id" gorm:"type:varchar(64);uniqueIndex:idx_webhook_delivery_event_endpoint,priority:1"`
+	EventType      WebhookEventType      `json:"event_type" gorm:"type:varchar(32)"`
+	Payload        string                `json:"payload" gorm:"type:text"`
+	Status         WebhookDeliveryStatus `json:"status" gorm:"type:varchar(16);index"`
+	Attempts       int                   `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at" gorm:"index"`
+	LastStatusCode int                   `json:"last_status_code,omitempty"`
+	LastError      string                `json:"last_error,omitempty" gorm:"type:text"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time             `json:"created_at" gorm:"index"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+// WebhookDeliveryAttempt 记录每一次 HTTP 投递的结果。
+type WebhookDeliveryAttempt struct {
+	ID           uint64    `json:"id" gorm:"primaryKey;autoIncrement"`
+	DeliveryID   string    `json:"delivery_id" gorm:"type:varchar(64);index"`
+	Attempt      int       `json:"attempt"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty" gorm:"type:text"`
+	ResponseBody string    `json:"response_body,omitempty" gorm:"type:text"`
+	DurationMs   int64     `json:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (WebhookDeliveryAttempt) TableName() string {
+	return "webhook_delivery_attempt"
+}
+
+// NewEventID 生成事件 ID，订单 outbox 事件与退款事件共用，商户按它去重。
+func NewEventID() string {
+	return "evt_" + generateID()
+}
+
+// NewWebhookSecret 生成签名密钥，只在创建回调地址时返回给调用方一次。
+func NewWebhookSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,412 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+type WebhookStore interface {
+	CreateEndpoint(endpoint *WebhookEndpoint) error
+	GetEndpoint(id string) (*WebhookEndpoint, bool)
+	ListEndpoints() []*WebhookEndpoint
+	UpdateEndpoint(endpoint *WebhookEndpoint) error
+
+	// CreateDeliveries 保存投递，同一事件对同一回调地址已有投递时跳过，返回实际新建的投递。
+	CreateDeliveries(deliveries []*WebhookDelivery) ([]*WebhookDelivery, error)
+	GetDelivery(id string) (*WebhookDelivery, bool)
+	ListDeliveries(endpointID string, limit int) []*WebhookDelivery
+	// ListDueDeliveries 返回 next_attempt_at 已到期的 pending 投递，最早到期的在前。
+	ListDueDeliveries(now time.Time, limit int) []*WebhookDelivery
+	// ClaimDelivery 仅当投递仍是 pending 且次数仍是 attempts 时把次数加一并推迟到 next，
+	// 保证同一次投递只被一个实例发送。
+	ClaimDelivery(id string, attempts int, next time.Time) (bool, error)
+	// FinishAttempt 写入一次投递记录并更新投递状态。
+	FinishAttempt(delivery *WebhookDelivery, attempt *WebhookDeliveryAttempt) error
+	// Redeliver 把投递重新置为 pending 并立即到期，失败或已成功的投递都可以重新投递。
+	Redeliver(id string) (*WebhookDelivery, error)
+	ListAttempts(deliveryID string) []*WebhookDeliveryAttempt
+}
+
+type InMemoryWebhookStore struct {
+	mu         sync.RWMutex
+	endpoints  map[string]*WebhookEndpoint
+	deliveries map[string]*WebhookDelivery
+	attempts   []*WebhookDeliveryAttempt
+	seq        uint64
+}
+
+var Webhooks WebhookStore = &InMemoryWebhookStore{
+	endpoints:  make(map[string]*WebhookEndpoint),
+	deliveries: make(map[string]*WebhookDelivery),
+}
+
+func (s *InMemoryWebhookStore) CreateEndpoint(endpoint *WebhookEndpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if endpoint.ID == "" {
+		endpoint.ID = generateID()
+	}
+	endpoint.CreatedAt = time.Now()
+	endpoint.UpdatedAt = endpoint.CreatedAt
+	s.endpoints[endpoint.ID] = endpoint
+	return nil
+}
+
+func (s *InMemoryWebhookStore) GetEndpoint(id string) (*WebhookEndpoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	endpoint, exists := s.endpoints[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *endpoint
+	return &copied, true
+}
+
+func (s *InMemoryWebhookStore) ListEndpoints() []*WebhookEndpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	endpoints := make([]*WebhookEndpoint, 0, len(s.endpoints))
+	for _, endpoint := range s.endpoints {
+		copied := *endpoint
+		endpoints = append(endpoints, &copied)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].CreatedAt.Before(endpoints[j].CreatedAt)
+	})
+	return endpoints
+}
+
+func (s *InMemoryWebhookStore) UpdateEndpoint(endpoint *WebhookEndpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.endpoints[endpoint.ID]; !exists {
+		return ErrWebhookNotFound
+	}
+	endpoint.UpdatedAt = time.Now()
+	copied := *endpoint
+	s.endpoints[endpoint.ID] = &copied
+	return nil
+}
+
+func (s *InMemoryWebhookStore) CreateDeliveries(deliveries []*WebhookDelivery) ([]*WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	created := make([]*WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		if s.hasDeliveryLocked(d.EventID, d.EndpointID) {
+			continue
+		}
+		setWebhookDeliveryDefaults(d, now)
+		copied := *d
+		s.deliveries[d.ID] = &copied
+		created = append(created, d)
+	}
+	return created, nil
+}
+
+func (s *InMemoryWebhookStore) hasDeliveryLocked(eventID, endpointID string) bool {
+	for _, d := range s.deliveries {
+		if d.EventID == eventID && d.EndpointID == endpointID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *InMemoryWebhookStore) GetDelivery(id string) (*WebhookDelivery, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, exists := s.deliveries[id]
+	if !exists {
+		return nil, false
+	}
+	copied := *d
+	return &copied, true
+}
+
+func (s *InMemoryWebhookStore) ListDeliveries(endpointID string, limit int) []*WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]*WebhookDelivery, 0)
+	for _, d := range s.deliveries {
+		if d.EndpointID == endpointID {
+			copied := *d
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries
+}
+
+func (s *InMemoryWebhookStore) ListDueDeliveries(now time.Time, limit int) []*WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]*WebhookDelivery, 0)
+	for _, d := range s.deliveries {
+		if d.Status == WebhookDeliveryPending && !d.NextAttemptAt.After(now) {
+			copied := *d
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+	})
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries
+}
+
+func (s *InMemoryWebhookStore) ClaimDelivery(id string, attempts int, next time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, exists := s.deliveries[id]
+	if !exists || d.Status != WebhookDeliveryPending || d.Attempts != attempts {
+		return false, nil
+	}
+	d.Attempts++
+	d.NextAttemptAt = next
+	d.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (s *InMemoryWebhookStore) FinishAttempt(delivery *WebhookDelivery, attempt *WebhookDeliveryAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, exists := s.deliveries[delivery.ID]
+	if !exists {
+		return ErrWebhookNotFound
+	}
+	now := time.Now()
+	s.seq++
+	attempt.ID = s.seq
+	attempt.CreatedAt = now
+	s.attempts = append(s.attempts, attempt)
+
+	d.Status = delivery.Status
+	d.NextAttemptAt = delivery.NextAttemptAt
+	d.LastStatusCode = delivery.LastStatusCode
+	d.LastError = delivery.LastError
+	d.DeliveredAt = delivery.DeliveredAt
+	d.UpdatedAt = now
+	return nil
+}
+
+func (s *InMemoryWebhookStore) Redeliver(id string) (*WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, exists := s.deliveries[id]
+	if !exists {
+		return nil, ErrWebhookNotFound
+	}
+	d.Status = WebhookDeliveryPending
+	d.NextAttemptAt = time.Now()
+	d.UpdatedAt = d.NextAttemptAt
+	copied := *d
+	return &copied, nil
+}
+
+func (s *InMemoryWebhookStore) ListAttempts(deliveryID string) []*WebhookDeliveryAttempt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	attempts := make([]*WebhookDeliveryAttempt, 0)
+	for _, a := range s.attempts {
+		if a.DeliveryID == deliveryID {
+			attempts = append(attempts, a)
+		}
+	}
+	return attempts
+}
+
+func setWebhookDeliveryDefaults(d *WebhookDelivery, now time.Time) {
+	if d.ID == "" {
+		d.ID = generateID()
+	}
+	if d.Status == "" {
+		d.Status = WebhookDeliveryPending
+	}
+	if d.NextAttemptAt.IsZero() {
+		d.NextAttemptAt = now
+	}
+	d.CreatedAt = now
+	d.UpdatedAt = now
+}
+
+type GormWebhookStore struct {
+	db *gorm.DB
+}
+
+func InitGormWebhookStore(db *gorm.DB) error {
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	if err := db.AutoMigrate(&WebhookEndpoint{}, &WebhookDelivery{}, &WebhookDeliveryAttempt{}); err != nil {
+		return err
+	}
+	Webhooks = &GormWebhookStore{db: db}
+	return nil
+}
+
+func (s *GormWebhookStore) CreateEndpoint(endpoint *WebhookEndpoint) error {
+	if endpoint.ID == "" {
+		endpoint.ID = generateID()
+	}
+	now := time.Now()
+	endpoint.CreatedAt = now
+	endpoint.UpdatedAt = now
+	return s.db.Create(endpoint).Error
+}
+
+func (s *GormWebhookStore) GetEndpoint(id string) (*WebhookEndpoint, bool) {
+	var endpoint WebhookEndpoint
+	if err := s.db.First(&endpoint, "id = ?", id).Error; err != nil {
+		return nil, false
+	}
+	return &endpoint, true
+}
+
+func (s *GormWebhookStore) ListEndpoints() []*WebhookEndpoint {
+	var endpoints []*WebhookEndpoint
+	_ = s.db.Order("created_at asc").Find(&endpoints).Error
+	return endpoints
+}
+
+func (s *GormWebhookStore) UpdateEndpoint(endpoint *WebhookEndpoint) error {
+	endpoint.UpdatedAt = time.Now()
+	res := s.db.Model(&WebhookEndpoint{}).Where("id = ?", endpoint.ID).Updates(map[string]any{
+		"url":         endpoint.URL,
+		"events":      endpoint.Events,
+		"description": endpoint.Description,
+		"enabled":     endpoint.Enabled,
+		"updated_at":  endpoint.UpdatedAt,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *GormWebhookStore) CreateDeliveries(deliveries []*WebhookDelivery) ([]*WebhookDelivery, error) {
+	now := time.Now()
+	created := make([]*WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		setWebhookDeliveryDefaults(d, now)
+		res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(d)
+		if res.Error != nil {
+			return created, res.Error
+		}
+		if res.RowsAffected > 0 {
+			created = append(created, d)
+		}
+	}
+	return created, nil
+}
+
+func (s *GormWebhookStore) GetDelivery(id string) (*WebhookDelivery, bool) {
+	var d WebhookDelivery
+	if err := s.db.First(&d, "id = ?", id).Error; err != nil {
+		return nil, false
+	}
+	return &d, true
+}
+
+func (s *GormWebhookStore) ListDeliveries(endpointID string, limit int) []*WebhookDelivery {
+	var deliveries []*WebhookDelivery
+	q := s.db.Where("endpoint_id = ?", endpointID).Order("created_at desc")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	_ = q.Find(&deliveries).Error
+	return deliveries
+}
+
+func (s *GormWebhookStore) ListDueDeliveries(now time.Time, limit int) []*WebhookDelivery {
+	var deliveries []*WebhookDelivery
+	_ = s.db.Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryPending, now).
+		Order("next_attempt_at asc").Limit(limit).Find(&deliveries).Error
+	return deliveries
+}
+
+func (s *GormWebhookStore) ClaimDelivery(id string, attempts int, next time.Time) (bool, error) {
+	res := s.db.Model(&WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ?", id, WebhookDeliveryPending, attempts).
+		Updates(map[string]any{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": next,
+			"updated_at":      time.Now(),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (s *GormWebhookStore) FinishAttempt(delivery *WebhookDelivery, attempt *WebhookDeliveryAttempt) error {
+	now := time.Now()
+	attempt.CreatedAt = now
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]any{
+			"status":           delivery.Status,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"delivered_at":     delivery.DeliveredAt,
+			"updated_at":       now,
+		}).Error
+	})
+}
+
+func (s *GormWebhookStore) Redeliver(id string) (*WebhookDelivery, error) {
+	now := time.Now()
+	res := s.db.Model(&WebhookDelivery{}).Where("id = ?", id).Updates(map[string]any{
+		"status":          WebhookDeliveryPending,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	d, _ := s.GetDelivery(id)
+	return d, nil
+}
+
+func (s *GormWebhookStore) ListAttempts(deliveryID string) []*WebhookDeliveryAttempt {
+	var attempts []*WebhookDeliveryAttempt
+	_ = s.db.Where("delivery_id = ?", deliveryID).Order("id asc").Find(&attempts).Error
+	return attempts
+}